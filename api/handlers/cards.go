@@ -0,0 +1,499 @@
+package handlers
+
+import (
+	"website/internal/cardsheet"
+	"website/internal/settlement"
+	"website/utils/database/models/cards"
+	"website/web/templates"
+
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const (
+	// maxCardBatch limits how many cards can be created at once
+	maxCardBatch = 500
+
+	// defaultCardPage and maxCardPage are the default and largest number of cards per page
+	defaultCardPage = 50
+	maxCardPage     = 500
+)
+
+// CardListResponse represents a page of cards
+type CardListResponse struct {
+	Cards []cards.Card `json:"cards"`
+	Total int64        `json:"total"`
+	Page  int64        `json:"page"`
+	Limit int64        `json:"limit"`
+}
+
+// CardBatchResponse represents a batch of created cards
+type CardBatchResponse struct {
+	Batch string       `json:"batch"`
+	Cards []cards.Card `json:"cards"`
+}
+
+// CardReplacementResponse represents a blocked card together with the card replacing it
+type CardReplacementResponse struct {
+	Blocked     *cards.Card `json:"blocked"`
+	Replacement *cards.Card `json:"replacement"`
+}
+
+// parseCardFilter reads the card filter from the query parameters
+func parseCardFilter(r *http.Request) (cards.Filter, error) {
+	var filter cards.Filter
+	query := r.URL.Query()
+
+	// Read which product the balance filters apply to, all products by default
+	if value := query.Get("product"); value != "" {
+		product, err := findProduct(r.Context(), value)
+		if err != nil {
+			return filter, err
+		}
+		filter.ProductID = product.ID
+	}
+
+	// Read the balance range
+	for key, target := range map[string]**uint{"min_balance": &filter.MinBalance, "max_balance": &filter.MaxBalance} {
+		if value := query.Get(key); value != "" {
+			balance, err := strconv.ParseUint(value, 10, 32)
+			if err != nil {
+				return filter, err
+			}
+			converted := uint(balance)
+			*target = &converted
+		}
+	}
+
+	// Read the range of the last purchase, both days are included
+	if value := query.Get("purchased_after"); value != "" {
+		day, err := time.ParseInLocation("2006-01-02", value, time.Local)
+		if err != nil {
+			return filter, err
+		}
+		filter.PurchasedAfter = day
+	}
+	if value := query.Get("purchased_before"); value != "" {
+		day, err := time.ParseInLocation("2006-01-02", value, time.Local)
+		if err != nil {
+			return filter, err
+		}
+		filter.PurchasedBefore = day.AddDate(0, 0, 1)
+	}
+
+	return filter, nil
+}
+
+// getCardByServerID fetches the card with the server ID in the URL path parameters,
+// writing the error response when that fails
+func getCardByServerID(w http.ResponseWriter, r *http.Request) (*cards.Card, bool) {
+	// Parse the server ID from the URL path parameters
+	id, err := strconv.ParseUint(mux.Vars(r)["server_id"], 10, 64)
+	if err != nil {
+		http.Error(w, "Supplied wrong id", http.StatusBadRequest)
+		return nil, false
+	}
+
+	// Retrieve card information from the database
+	card, err := cards.GetByServerID(r.Context(), id)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		http.Error(w, "Card not found", http.StatusNotFound)
+		return nil, false
+	} else if err != nil {
+		http.Error(w, "Failed to retrieve card", http.StatusInternalServerError)
+		return nil, false
+	}
+
+	return card, true
+}
+
+// OwnerCardsPage handles GET requests meant for viewing the card management page
+func OwnerCardsPage(w http.ResponseWriter, r *http.Request) {
+	// Send visitors without authentication to the login page
+	authHeader := r.Header.Get("Authorization")
+	if authHeader == "" {
+		http.Redirect(w, r, "/owner", http.StatusSeeOther)
+		return
+	}
+
+	// Set the Content-Type header to specify that the response is HTML
+	w.Header().Set("Content-Type", "text/html")
+
+	// Render the page
+	data := struct {
+		Name string
+	}{
+		os.Getenv("NAME"),
+	}
+	if err := templates.RenderHTML(w, "cards.html", data); err != nil {
+		http.Error(w, "Failed to render HTML template", http.StatusInternalServerError)
+		return
+	}
+}
+
+// OwnerCardsGet handles GET requests for listing cards, a page at a time
+func OwnerCardsGet(w http.ResponseWriter, r *http.Request) {
+	// Check the authentication
+	authHeader := r.Header.Get("Authorization")
+	if authHeader == "" {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	// Parse the filter
+	filter, err := parseCardFilter(r)
+	if err != nil {
+		http.Error(w, "Invalid filter", http.StatusBadRequest)
+		return
+	}
+
+	// Parse the page, starting at page 1
+	page, limit := int64(1), int64(defaultCardPage)
+	if value := r.URL.Query().Get("page"); value != "" {
+		page, err = strconv.ParseInt(value, 10, 64)
+		if err != nil || page < 1 {
+			http.Error(w, "Invalid page", http.StatusBadRequest)
+			return
+		}
+	}
+	if value := r.URL.Query().Get("limit"); value != "" {
+		limit, err = strconv.ParseInt(value, 10, 64)
+		if err != nil || limit < 1 || limit > maxCardPage {
+			http.Error(w, "Invalid limit", http.StatusBadRequest)
+			return
+		}
+	}
+
+	// Retrieve the cards from the database
+	list, total, err := cards.List(r.Context(), filter, (page-1)*limit, limit)
+	if err != nil {
+		http.Error(w, "Failed to retrieve cards", http.StatusInternalServerError)
+		return
+	}
+
+	// Return the cards
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(CardListResponse{Cards: list, Total: total, Page: page, Limit: limit})
+}
+
+// OwnerCardsPost handles POST requests for creating a single card or a batch of cards
+func OwnerCardsPost(w http.ResponseWriter, r *http.Request) {
+	// Check the authentication
+	authHeader := r.Header.Get("Authorization")
+	if authHeader == "" {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	// Parse how many cards to create, a single card by default
+	count := uint64(1)
+	if value := r.FormValue("count"); value != "" {
+		var err error
+		count, err = strconv.ParseUint(value, 10, 32)
+		if err != nil || count == 0 || count > maxCardBatch {
+			http.Error(w, "Invalid count", http.StatusBadRequest)
+			return
+		}
+	}
+
+	// Create the cards
+	batch := primitive.NewObjectID().Hex()
+	created := make([]cards.Card, count)
+	for i := range created {
+		card, err := cards.New(r.Context())
+		if err != nil {
+			http.Error(w, "Failed to create cards", http.StatusInternalServerError)
+			return
+		}
+		card.Batch = batch
+		created[i] = card
+	}
+
+	// Insert the cards into the database
+	if err := cards.InsertMany(r.Context(), created); err != nil {
+		http.Error(w, "Failed to save cards", http.StatusInternalServerError)
+		return
+	}
+
+	// Return the batch
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(CardBatchResponse{Batch: batch, Cards: created})
+}
+
+// getPublicCardURL builds the link to the client page of a card from the PUBLIC_URL environment
+// variable. Printed QR codes outlive the request, so they must not use the host the owner browses on.
+func getPublicCardURL(token string) (string, error) {
+	base, err := url.Parse(strings.TrimRight(os.Getenv("PUBLIC_URL"), "/"))
+	if err != nil || (base.Scheme != "http" && base.Scheme != "https") || base.Host == "" {
+		return "", errors.New("PUBLIC_URL must be set to the address customers reach the website at")
+	}
+	return fmt.Sprintf("%s/client/%s", base.String(), token), nil
+}
+
+// OwnerCardsSheet handles GET requests for downloading a printable PDF sheet of a batch of cards
+func OwnerCardsSheet(w http.ResponseWriter, r *http.Request) {
+	// Check the authentication
+	authHeader := r.Header.Get("Authorization")
+	if authHeader == "" {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	// Refuse to print QR codes that would point to a wrong address
+	if _, err := getPublicCardURL(""); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Retrieve the cards of the batch
+	batch := r.URL.Query().Get("batch")
+	if batch == "" {
+		http.Error(w, "Missing batch", http.StatusBadRequest)
+		return
+	}
+	list, err := cards.GetByBatch(r.Context(), batch)
+	if err != nil {
+		http.Error(w, "Failed to retrieve cards", http.StatusInternalServerError)
+		return
+	}
+	if len(list) == 0 {
+		http.Error(w, "Batch not found", http.StatusNotFound)
+		return
+	}
+
+	// Every QR code points to the client page of its card
+	sheet := make([]cardsheet.Card, len(list))
+	for i, card := range list {
+		link, _ := getPublicCardURL(card.Token)
+		sheet[i] = cardsheet.Card{ServerID: card.ServerID, URL: link}
+	}
+
+	// Return the sheet as a download
+	w.Header().Set("Content-Type", "application/pdf")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"cards-%d-%d.pdf\"", list[0].ServerID, list[len(list)-1].ServerID))
+	if err := cardsheet.WritePDF(w, os.Getenv("NAME"), sheet); err != nil {
+		http.Error(w, "Failed to create the sheet", http.StatusInternalServerError)
+		return
+	}
+}
+
+// OwnerCardAdjust handles POST requests for correcting the balance of a card
+func OwnerCardAdjust(w http.ResponseWriter, r *http.Request) {
+	// Check the authentication
+	authHeader := r.Header.Get("Authorization")
+	if authHeader == "" {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	// Parse the change, negative values take beers from the card
+	change, err := strconv.ParseInt(r.FormValue("beers"), 10, 32)
+	if err != nil || change == 0 {
+		http.Error(w, "Invalid number of beers", http.StatusBadRequest)
+		return
+	}
+
+	// Every correction needs a reason in the history of the card
+	reason := strings.TrimSpace(r.FormValue("reason"))
+	if reason == "" {
+		http.Error(w, "A reason is required", http.StatusBadRequest)
+		return
+	}
+
+	// Fetch the product of the balance
+	product, err := findProduct(r.Context(), r.FormValue("product"))
+	if errors.Is(err, errNoProduct) {
+		http.Error(w, "Invalid product", http.StatusBadRequest)
+		return
+	} else if err != nil {
+		http.Error(w, "Could not fetch product", http.StatusInternalServerError)
+		return
+	}
+
+	// Fetch the card
+	card, ok := getCardByServerID(w, r)
+	if !ok {
+		return
+	}
+
+	// Adjust the balance
+	err = settlement.Adjust(r.Context(), card.ID, product.ID, change, reason)
+	if errors.Is(err, cards.ErrNoBeers) {
+		http.Error(w, "Not enough beers on the card", http.StatusConflict)
+		return
+	} else if err != nil {
+		http.Error(w, "Failed to adjust the balance", http.StatusInternalServerError)
+		return
+	}
+
+	// Return the updated card
+	card, err = cards.GetByID(r.Context(), card.ID)
+	if err != nil {
+		http.Error(w, "Failed to retrieve card", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(card)
+}
+
+// OwnerCardBlock handles POST requests for blocking a lost or stolen card and moving its
+// remaining balance onto a newly issued card
+func OwnerCardBlock(w http.ResponseWriter, r *http.Request) {
+	// Check the authentication
+	authHeader := r.Header.Get("Authorization")
+	if authHeader == "" {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	// The reason ends up in the history of both cards
+	reason := strings.TrimSpace(r.FormValue("reason"))
+	if reason == "" {
+		reason = "card blocked"
+	}
+
+	// Fetch the card, a blocked card already has its replacement
+	card, ok := getCardByServerID(w, r)
+	if !ok {
+		return
+	}
+	if card.Blocked {
+		http.Error(w, "The card is already blocked, move later credits to its replacement instead", http.StatusConflict)
+		return
+	}
+
+	// Issue the replacement in its own batch, so its sheet can be printed
+	replacement, err := cards.New(r.Context())
+	if err != nil {
+		http.Error(w, "Failed to create the replacement card", http.StatusInternalServerError)
+		return
+	}
+	replacement.Batch = primitive.NewObjectID().Hex()
+
+	// Block the card and move its balance
+	err = settlement.Replace(r.Context(), card.ID, &replacement, reason)
+	if errors.Is(err, cards.ErrBlocked) {
+		http.Error(w, "The card is already blocked, move later credits to its replacement instead", http.StatusConflict)
+		return
+	} else if err != nil {
+		http.Error(w, "Failed to block the card", http.StatusInternalServerError)
+		return
+	}
+
+	// Return both cards
+	blocked, err := cards.GetByID(r.Context(), card.ID)
+	if err != nil {
+		http.Error(w, "Failed to retrieve card", http.StatusInternalServerError)
+		return
+	}
+	updated, err := cards.GetByID(r.Context(), replacement.ID)
+	if err != nil {
+		http.Error(w, "Failed to retrieve card", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(CardReplacementResponse{Blocked: blocked, Replacement: updated})
+}
+
+// OwnerCardMove handles POST requests for moving drinks credited to a blocked card after it was
+// blocked, such as late payments, onto the card that replaced it
+func OwnerCardMove(w http.ResponseWriter, r *http.Request) {
+	// Check the authentication
+	authHeader := r.Header.Get("Authorization")
+	if authHeader == "" {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	// The reason ends up in the history of both cards
+	reason := strings.TrimSpace(r.FormValue("reason"))
+	if reason == "" {
+		reason = "credited after the card was blocked"
+	}
+
+	// Fetch the card
+	card, ok := getCardByServerID(w, r)
+	if !ok {
+		return
+	}
+
+	// Move the balance to the replacement
+	replacement, err := settlement.MoveToReplacement(r.Context(), card.ID, reason)
+	if errors.Is(err, settlement.ErrNotBlocked) || errors.Is(err, settlement.ErrNoReplacement) ||
+		errors.Is(err, settlement.ErrNothingToMove) {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	} else if errors.Is(err, cards.ErrBlocked) {
+		http.Error(w, "The replacement card is blocked as well", http.StatusConflict)
+		return
+	} else if errors.Is(err, mongo.ErrNoDocuments) {
+		http.Error(w, "The replacement card no longer exists", http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, "Failed to move the balance", http.StatusInternalServerError)
+		return
+	}
+
+	// Return both cards
+	blocked, err := cards.GetByID(r.Context(), card.ID)
+	if err != nil {
+		http.Error(w, "Failed to retrieve card", http.StatusInternalServerError)
+		return
+	}
+	updated, err := cards.GetByID(r.Context(), replacement.ID)
+	if err != nil {
+		http.Error(w, "Failed to retrieve card", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(CardReplacementResponse{Blocked: blocked, Replacement: updated})
+}
+
+// OwnerCardDelete handles DELETE requests for removing a card
+func OwnerCardDelete(w http.ResponseWriter, r *http.Request) {
+	// Check the authentication
+	authHeader := r.Header.Get("Authorization")
+	if authHeader == "" {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	// Fetch the card
+	card, ok := getCardByServerID(w, r)
+	if !ok {
+		return
+	}
+
+	// Delete the card, drinks on it must be taken off with a reason first so they stay accounted for
+	err := settlement.DeleteCard(r.Context(), card.ID)
+	if errors.Is(err, cards.ErrNotEmpty) {
+		http.Error(w, "The card still has beers, adjust its balance to zero first", http.StatusConflict)
+		return
+	} else if errors.Is(err, cards.ErrAdminCard) {
+		http.Error(w, "The admin card cannot be deleted", http.StatusConflict)
+		return
+	} else if errors.Is(err, settlement.ErrOpenOrders) {
+		http.Error(w, "The card has orders that are not settled yet", http.StatusConflict)
+		return
+	} else if errors.Is(err, mongo.ErrNoDocuments) {
+		http.Error(w, "Card does not exist", http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, "Failed to delete card", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -1,51 +1,98 @@
 package handlers
 
 import (
+	"website/internal/expiry"
+	"website/internal/pricing"
 	"website/utils/database/models/cards"
+	"website/utils/database/models/products"
 	"website/web/templates"
 	
-	"fmt"
 	"net/http"
 	"os"
-	"strconv"
+	"time"
 
 	"github.com/gorilla/mux"
+	"go.mongodb.org/mongo-driver/mongo"
 )
 
+// ClientProduct represents a product on the client page together with its balance on the card
+type ClientProduct struct {
+	ID     string
+	Name   string
+	Symbol string
+	Price  string
+	Rule   string
+	Beers  uint
+}
+
 // ClientGet handles GET requests to the client page
 func ClientGet(w http.ResponseWriter, r *http.Request) {
-	// Extract card_id variable from the URL path parameters.
+	// Extract the token variable from the URL path parameters.
 	vars := mux.Vars(r)
-	serverID := vars["server_id"]
+	token := vars["token"]
 
-	// Parse the serverID
-	id, err := strconv.ParseUint(serverID, 10, 64)
-	if err != nil {
-		http.Error(w, "Supplied wrong id", http.StatusBadRequest)
+	// Retrieve card information from the database
+	card, err := cards.GetByToken(r.Context(), token)
+	if err == mongo.ErrNoDocuments {
+		http.Error(w, "Card does not exist", http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, "Failed to retrieve card", http.StatusInternalServerError)
 		return
 	}
 
-	// Retrieve card information from the database
-	card, err := cards.GetByServerID(r.Context(), id)
-	if err != nil {
-		http.Error(w, "Failed to retrieve card", http.StatusInternalServerError)
+	// A blocked card was lost or stolen and can no longer be used
+	if card.Blocked {
+		http.Error(w, "This card is blocked, ask the bar for a replacement", http.StatusForbidden)
 		return
 	}
 	
-	// Convert the price to float for formatting
-	price, err := strconv.ParseFloat(os.Getenv("PRICE"), 64)
+	// Retrieve the products for sale
+	active, err := products.GetActive(r.Context())
+	if err != nil {
+		http.Error(w, "Failed to retrieve products", http.StatusInternalServerError)
+		return
+	}
+
+	// Combine every product with its current price and its balance on the card
+	now := time.Now()
+	productData := make([]ClientProduct, len(active))
+	for i, product := range active {
+		quote := pricing.Price(product, 1, now)
+		productData[i] = ClientProduct{
+			ID:     product.ID.Hex(),
+			Name:   product.Name,
+			Symbol: quote.Total.Symbol(),
+			Price:  quote.Total.String(),
+			Rule:   quote.Rule,
+			Beers:  card.Balance(product.ID),
+		}
+	}
+
+	// Warn the customer when the balance of the card is about to expire
+	expiresAt := ""
+	if policy := expiry.Get(); card.Total() > 0 && policy.Warn(card.LastActive(), now) {
+		date, _ := policy.ExpiresAt(card.LastActive())
+		expiresAt = date.Format("2 January 2006")
+	}
 
 	// Setup the client page variables
 	data := struct {
-		Name    string
-		Price   string
-		Beers   uint
-		ID		uint
+		Name     string
+		Products []ClientProduct
+		ID		 uint
+		Token    string
+		HasPIN   bool
+		PINPours bool
+		Expires  string
 	}{
-		Name:  	os.Getenv("NAME"),
-		Price: 	fmt.Sprintf("%.2f", price),
-		Beers: 	card.Beers,
-		ID:		uint(card.ServerID),
+		Name:     os.Getenv("NAME"),
+		Products: productData,
+		ID:		  uint(card.ServerID),
+		Token:    card.Token,
+		HasPIN:   card.HasPIN(),
+		PINPours: card.PINForPours,
+		Expires:  expiresAt,
 	}
 
 	// Set the Content-Type header to specify that the response is HTML
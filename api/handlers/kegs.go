@@ -0,0 +1,232 @@
+package handlers
+
+import (
+	"website/utils/database"
+	"website/utils/database/models/kegs"
+	"website/utils/database/models/products"
+	"website/utils/database/models/telemetry"
+
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// WeightData represents the JSON data structure for weight readings from the tap, in kilograms
+type WeightData struct {
+	Tap    string  `json:"tap"`
+	Weight float64 `json:"weight"`
+}
+
+// KegState represents the stored state of a keg as shown to the owner
+type KegState struct {
+	ID        string    `json:"id"`
+	Product   string    `json:"product"`
+	Tap       string    `json:"tap"`
+	Volume    float64   `json:"volume"`
+	Remaining float64   `json:"remaining"`
+	Level     int       `json:"level"`
+	TappedAt  time.Time `json:"tapped_at"`
+	WeighedAt time.Time `json:"weighed_at"`
+}
+
+// newKegState combines a keg with the name of its product
+func newKegState(keg kegs.Keg, productName string) KegState {
+	return KegState{
+		ID:        keg.ID.Hex(),
+		Product:   productName,
+		Tap:       keg.Tap,
+		Volume:    keg.Volume,
+		Remaining: math.Round(keg.Remaining()*10) / 10,
+		Level:     int(math.Round(keg.Level())),
+		TappedAt:  keg.TappedAt,
+		WeighedAt: keg.WeighedAt,
+	}
+}
+
+// getKegStates retrieves the state of every keg currently on a tap
+func getKegStates(ctx context.Context) ([]KegState, error) {
+	tapped, err := kegs.GetTapped(ctx)
+	if err != nil {
+		return nil, err
+	}
+	all, err := products.GetAll(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// Look up the name of the product in every keg
+	names := make(map[primitive.ObjectID]string, len(all))
+	for _, product := range all {
+		names[product.ID] = product.Name
+	}
+	states := make([]KegState, len(tapped))
+	for i, keg := range tapped {
+		states[i] = newKegState(keg, names[keg.ProductID])
+	}
+
+	return states, nil
+}
+
+// TapWeight handles POST requests from the tap reporting the weight of the keg on a tap
+func TapWeight(w http.ResponseWriter, r *http.Request) {
+	// Parse JSON data from the request body into weightData struct
+	var weightData WeightData
+	if err := json.NewDecoder(r.Body).Decode(&weightData); err != nil {
+		http.Error(w, "Failed to decode JSON data", http.StatusBadRequest)
+		return
+	}
+	if weightData.Weight < 0 || math.IsNaN(weightData.Weight) || math.IsInf(weightData.Weight, 0) {
+		http.Error(w, "Invalid weight", http.StatusBadRequest)
+		return
+	}
+
+	// Store the reading on the keg of the tap
+	now := time.Now()
+	keg, err := kegs.UpdateWeight(r.Context(), weightData.Tap, weightData.Weight, now)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		http.Error(w, "No keg is tapped on this tap", http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, "Failed to store weight", http.StatusInternalServerError)
+		return
+	}
+
+	// Add the reading to the history, the keg is already up to date so a failure here is only logged
+	if err := telemetry.Record(r.Context(), keg.ID, keg.Tap, weightData.Weight, keg.Level(), now); err != nil {
+		log.Printf("[Warning] failed to record the weight of tap %q: %v", keg.Tap, err)
+	}
+
+	// Return the new state of the keg
+	product, err := products.GetByID(r.Context(), keg.ProductID)
+	name := ""
+	if err == nil {
+		name = product.Name
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(newKegState(*keg, name))
+}
+
+// OwnerKegsGet handles GET requests for the state of the kegs on the taps
+func OwnerKegsGet(w http.ResponseWriter, r *http.Request) {
+	// Check the authentication
+	authHeader := r.Header.Get("Authorization")
+	if authHeader == "" {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	// Retrieve the kegs from the database
+	states, err := getKegStates(r.Context())
+	if err != nil {
+		http.Error(w, "Failed to retrieve kegs", http.StatusInternalServerError)
+		return
+	}
+
+	// Return the kegs
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(states)
+}
+
+// OwnerKegsPost handles POST requests for tapping a new keg, which takes the previous keg off its tap
+func OwnerKegsPost(w http.ResponseWriter, r *http.Request) {
+	// Check the authentication
+	authHeader := r.Header.Get("Authorization")
+	if authHeader == "" {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	// Parse the volume in liters and the weight of the empty keg in kilograms
+	volume, err := strconv.ParseFloat(r.FormValue("volume"), 64)
+	if err != nil || volume <= 0 {
+		http.Error(w, "Invalid volume", http.StatusBadRequest)
+		return
+	}
+	tare, err := strconv.ParseFloat(r.FormValue("tare"), 64)
+	if err != nil || tare < 0 {
+		http.Error(w, "Invalid tare weight", http.StatusBadRequest)
+		return
+	}
+
+	// Fetch the product in the keg
+	product, err := findProduct(r.Context(), r.FormValue("product"))
+	if errors.Is(err, errNoProduct) {
+		http.Error(w, "Invalid product", http.StatusBadRequest)
+		return
+	} else if err != nil {
+		http.Error(w, "Could not fetch product", http.StatusInternalServerError)
+		return
+	}
+
+	// The keg goes on the tap of its product unless another tap is given
+	tap := strings.TrimSpace(r.FormValue("tap"))
+	if tap == "" {
+		tap = product.Tap
+	}
+	if tap == "" {
+		http.Error(w, "The product has no tap, choose a tap for the keg", http.StatusBadRequest)
+		return
+	}
+
+	// Take the previous keg off the tap and insert the keg together, so a tap never has two kegs
+	keg := kegs.New(product.ID, tap, volume, tare)
+	keg.ID = primitive.NewObjectID()
+	err = database.WithTransaction(r.Context(), func(ctx context.Context) error {
+		if err := kegs.Untap(ctx, tap, keg.ID); err != nil {
+			return err
+		}
+		_, err := kegs.Insert(ctx, &keg)
+		return err
+	})
+	if mongo.IsDuplicateKeyError(err) {
+		http.Error(w, "Another keg was tapped on this tap at the same time", http.StatusConflict)
+		return
+	} else if err != nil {
+		http.Error(w, "Failed to tap the keg", http.StatusInternalServerError)
+		return
+	}
+
+	// Return the new keg
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(newKegState(keg, product.Name))
+}
+
+// OwnerKegUntap handles POST requests for taking a keg off its tap
+func OwnerKegUntap(w http.ResponseWriter, r *http.Request) {
+	// Check the authentication
+	authHeader := r.Header.Get("Authorization")
+	if authHeader == "" {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	// Convert the keg ID from the URL path parameters to primitive.ObjectID
+	objectID, err := primitive.ObjectIDFromHex(mux.Vars(r)["keg_id"])
+	if err != nil {
+		http.Error(w, "Invalid ID", http.StatusBadRequest)
+		return
+	}
+
+	// Take the keg off its tap
+	err = kegs.UntapByID(r.Context(), objectID)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		http.Error(w, "Keg is not tapped", http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, "Failed to untap keg", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,84 @@
+package handlers
+
+import (
+	"website/utils/database/models/cards"
+	"website/utils/database/models/ledger"
+
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+)
+
+// LedgerResponse represents the history of a card together with its derived balances
+type LedgerResponse struct {
+	ServerID   uint64           `json:"server_id"`
+	Balances   map[string]uint  `json:"balances"`
+	Derived    map[string]int64 `json:"derived"`
+	Consistent bool             `json:"consistent"`
+	Entries    []ledger.Entry   `json:"entries"`
+}
+
+// isConsistent reports whether the balances of a card match the balances derived from its history
+func isConsistent(balances map[string]uint, derived map[string]int64) bool {
+	for product, balance := range balances {
+		if derived[product] != int64(balance) {
+			return false
+		}
+	}
+	for product, balance := range derived {
+		if int64(balances[product]) != balance {
+			return false
+		}
+	}
+	return true
+}
+
+// OwnerCardLedger handles GET requests for viewing the history of a card
+func OwnerCardLedger(w http.ResponseWriter, r *http.Request) {
+	// Check the authentication
+	authHeader := r.Header.Get("Authorization")
+	if authHeader == "" {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	// Parse the server ID from the URL path parameters
+	id, err := strconv.ParseUint(mux.Vars(r)["server_id"], 10, 64)
+	if err != nil {
+		http.Error(w, "Supplied wrong id", http.StatusBadRequest)
+		return
+	}
+
+	// Retrieve card information from the database
+	card, err := cards.GetByServerID(r.Context(), id)
+	if err != nil {
+		http.Error(w, "Failed to retrieve card", http.StatusNotFound)
+		return
+	}
+
+	// Retrieve the history of the card
+	entries, err := ledger.GetByCardID(r.Context(), card.ID)
+	if err != nil {
+		http.Error(w, "Failed to retrieve card history", http.StatusInternalServerError)
+		return
+	}
+
+	// Derive the balances from the history to verify them against the card
+	derived, err := ledger.Balances(r.Context(), card.ID)
+	if err != nil {
+		http.Error(w, "Failed to derive card balance", http.StatusInternalServerError)
+		return
+	}
+
+	// Return the history
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(LedgerResponse{
+		ServerID:   card.ServerID,
+		Balances:   card.Balances,
+		Derived:    derived,
+		Consistent: isConsistent(card.Balances, derived),
+		Entries:    entries,
+	})
+}
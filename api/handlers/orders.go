@@ -1,27 +1,30 @@
 package handlers
 
 import (
-	"website/internal/payment/fakepay"
+	"website/internal/payment"
+	"website/internal/pricing"
+	"website/internal/settlement"
 	"website/utils/database/models/cards"
 	"website/utils/database/models/orders"
 	
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"os"
 	"strconv"
-	"strings"
 	"time"
 
 	"github.com/gorilla/mux"
-	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
 )
 
 // PaymentData represents the JSON data structure for payment requests.
 type PaymentData struct {
 	Quantity string `json:"quantity"`
-	ID       string `json:"id"`
+	Token    string `json:"token"`
+	Product  string `json:"product"`
 }
 
 // Function to determine the correct webhook URL based on the request scheme (HTTP or HTTPS)
@@ -35,13 +38,21 @@ func getWebhookURL(r *http.Request, orderID string) string {
 }
 
 // Function to determine the correct redirect URL based on the request scheme (HTTP or HTTPS)
-func getRedirectURL(r *http.Request, clientID string) string {
+func getRedirectURL(r *http.Request, token string) string {
     scheme := "https"
     if r.TLS == nil {
         // Request is not over HTTPS, use HTTP instead
         scheme = "http"
     }
-    return fmt.Sprintf("%s://%s/client/%s", scheme, r.Host, clientID)
+    return fmt.Sprintf("%s://%s/client/%s", scheme, r.Host, token)
+}
+
+// getCurrency reads the currency prices are set in from the CURRENCY environment variable
+func getCurrency() string {
+	if currency := os.Getenv("CURRENCY"); currency != "" {
+		return currency
+	}
+	return "EUR"
 }
 
 // OrderPost handles POST requests for creating orders
@@ -53,82 +64,83 @@ func OrderPost(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Parse server ID from payment data
-	id, err := strconv.ParseUint(paymentData.ID, 10, 64)
+	// Fetch card details by the secret token, so only holders of the card can top it up
+	card, err := cards.GetByToken(r.Context(), paymentData.Token)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Invalid server ID: %v", err), http.StatusBadRequest)
+		http.Error(w, "Could not fetch Card", http.StatusBadRequest)
 		return
 	}
-
-	// Fetch card details by server ID
-	card, err := cards.GetByServerID(r.Context(), id)
-	if err != nil {
-		http.Error(w, "Could not fetch Card", http.StatusBadRequest)
+	if card.Blocked {
+		http.Error(w, "This card is blocked", http.StatusForbidden)
 		return
 	}
 
 	// Parse quantity from payment data
-	quantity, err := strconv.ParseUint(paymentData.Quantity, 10, 64)
+	quantity, err := strconv.ParseUint(paymentData.Quantity, 10, 32)
 	if err != nil {
 		http.Error(w, fmt.Sprintf("Invalid quantity: %v", err), http.StatusBadRequest)
 		return
+	} else if quantity == 0 {
+		http.Error(w, "Invalid quantity: must be at least one", http.StatusBadRequest)
+		return
 	}
 
-	// Parse price from environment variable
-	price, err := strconv.ParseFloat(os.Getenv("PRICE"), 64)
-	if err != nil {
-		http.Error(w, fmt.Sprintf("Invalid price: %v", err), http.StatusInternalServerError)
+	// Fetch the chosen product and its price
+	product, err := findProduct(r.Context(), paymentData.Product)
+	if errors.Is(err, errNoProduct) {
+		http.Error(w, "Invalid product", http.StatusBadRequest)
+		return
+	} else if err != nil {
+		http.Error(w, "Could not fetch product", http.StatusInternalServerError)
 		return
 	}
 
+	// Price the order, applying the pricing rule that is active right now
+	quote := pricing.Price(*product, uint(quantity), time.Now())
+
 	// Create a new order with parsed data
-	order := orders.New(card.ID, uint(quantity), price)
+	order := orders.New(card.ID, product.ID, uint(quantity), quote.UnitPrice, quote.Total, quote.Rule)
 	_, err = orders.Insert(r.Context(), &order)
 	if err != nil {
 		http.Error(w, "Could not create an order", http.StatusInternalServerError)
 		return
 	}
 
-	// Prepare redirection URL for the transaction
-	var redirectURL string
-	if os.Getenv("ENVIRONMENT") == "production" {
-		redirectURL = "" // Actual payment gate space
-	} else {
-		// Prepare data for the transaction using fakepay processor
-		transactionInput := fakepay.FakepayTransactionInput{
-    		Amount:			order.TotalAmount,
-    		WebhookURL:		getWebhookURL(r, order.ID.Hex()),
-    		WebhookKey:		os.Getenv("WEBHOOK_KEY"),
-    		RedirectURL:	getRedirectURL(r, paymentData.ID),
-		}
-
-		// Obtain the modified redirect URL from the fakepay processor
-		redirectURL, err = fakepay.FakepayProcessor(transactionInput)
-		if err != nil {
-			http.Error(w, "Could not create a transaction", http.StatusInternalServerError)
-			return
-		}
-
-		// Extract the host part without the port from r.Host
-		hostParts := strings.Split(r.Host, ":")
-		host := hostParts[0]
+	// Create the payment at the payment provider
+	createdPayment, err := payment.Get().CreatePayment(r.Context(), payment.Input{
+		Reference:   order.ID.Hex(),
+		Description: fmt.Sprintf("%d x %s at %s", order.Quantity, product.Name, os.Getenv("NAME")),
+		Amount:      order.TotalAmount,
+		WebhookURL:  getWebhookURL(r, order.ID.Hex()),
+		RedirectURL: getRedirectURL(r, card.Token),
+	})
+	if err != nil {
+		http.Error(w, "Could not create a transaction", http.StatusInternalServerError)
+		return
+	}
 
-		// Modify the URL to replace "localhost" with the actual host
-		redirectURL = strings.Replace(redirectURL, "localhost", host, -1)
+	// Remember the payment so webhooks and status requests can be matched to the order
+	if err := orders.SetPaymentID(r.Context(), order.ID, createdPayment.ID); err != nil {
+		http.Error(w, "Could not update the order", http.StatusInternalServerError)
+		return
 	}
 
 	// Return the URL in the response
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusCreated)
-	json.NewEncoder(w).Encode(map[string]string{"url": redirectURL})
+	json.NewEncoder(w).Encode(map[string]string{"url": createdPayment.CheckoutURL})
 }
 
 // OrderUpdateStatus handles POST requests for updating order statuses.
 func OrderUpdateStatus(w http.ResponseWriter, r *http.Request) {
-	// Check Authorization header for valid credentials
-	if auth := r.Header.Get("Authorization"); auth != fmt.Sprintf("Bearer %s", os.Getenv("WEBHOOK_KEY")) {
+	// Let the payment provider authenticate the request and extract the update
+	event, err := payment.Get().ParseWebhook(r)
+	if errors.Is(err, payment.ErrUnauthorized) {
 		http.Error(w, "Unauthorized", http.StatusUnauthorized)
 		return
+	} else if err != nil {
+		http.Error(w, "Invalid webhook request", http.StatusBadRequest)
+		return
 	}
 
 	// Get the order_id variable from the URL path parameters.
@@ -142,54 +154,32 @@ func OrderUpdateStatus(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Get the order details from the database using the order ID.
-	order, err := orders.GetByID(r.Context(), objectID)
-	if err != nil {
-		http.Error(w, "Could not fetch order", http.StatusInternalServerError)
-		return
+	// Make sure the update is about the payment belonging to this order.
+	if event.PaymentID != "" {
+		order, err := orders.GetByID(r.Context(), objectID)
+		if err != nil {
+			http.Error(w, "Could not fetch order", http.StatusNotFound)
+			return
+		}
+		if order.PaymentID != event.PaymentID {
+			http.Error(w, "Payment does not belong to order", http.StatusBadRequest)
+			return
+		}
 	}
 
-	// Check if the order was already handled.
-	if order.Status != "Pending" {
+	// Settle the order and credit the card in one step, so retries cannot credit twice.
+	err = settlement.Settle(r.Context(), objectID, event.Status)
+	if errors.Is(err, orders.ErrAlreadyProcessed) {
 		http.Error(w, "Order was already processed", http.StatusOK)
 		return
-	}
-
-	// Parse the form data
-	err = r.ParseForm()
-	if err != nil {
-		http.Error(w, "Error parsing form data", http.StatusBadRequest)
-		return
-	}
-
-	// Access form fields by name
-	status := r.FormValue("Status")
-
-	// Update the order status.
-	order.Status = status
-
-	// Get the card details from the database using the card ID.
-	card, err := cards.GetByID(r.Context(), order.CardID)
-	if err != nil {
-		http.Error(w, "Could not fetch card", http.StatusInternalServerError)
+	} else if errors.Is(err, orders.ErrInvalidTransition) {
+		http.Error(w, "Invalid status transition", http.StatusConflict)
 		return
-	}
-
-	// Define the card updates.
-	updates := bson.M{
-		"beers":         card.Beers + order.Quantity,
-		"last_purchase": time.Now(),
-	}
-
-	// Update the card.
-	if err := cards.UpdateByID(r.Context(), card.ID, updates); err != nil {
-		http.Error(w, "Failed to update card", http.StatusInternalServerError)
+	} else if errors.Is(err, mongo.ErrNoDocuments) {
+		http.Error(w, "Could not fetch order", http.StatusNotFound)
 		return
-	}
-
-	// Update the order status in the database.
-	if err := orders.UpdateStatus(r.Context(), objectID, order.Status); err != nil {
-		http.Error(w, "Failed to update status", http.StatusInternalServerError)
+	} else if err != nil {
+		http.Error(w, "Failed to settle order", http.StatusInternalServerError)
 		return
 	}
 }
@@ -77,13 +77,19 @@ func OwnerGet(w http.ResponseWriter, r *http.Request) {
 			}
 			page = "login.html"
 		} else {
-			// Setup the owner page variables
+			// Setup the owner page variables from the stored keg state
+			states, err := getKegStates(r.Context())
+			if err != nil {
+				passwordMutex.Unlock()
+				http.Error(w, "Failed to retrieve kegs", http.StatusInternalServerError)
+				return
+			}
 			data = struct {
-				Name              string
-				RaspberryEndpoint string
+				Name string
+				Kegs []KegState
 			}{
 				os.Getenv("NAME"),
-				os.Getenv("RASPBERRY_ENDPOINT"),
+				states,
 			}
 			page = "owner.html"
 		}
@@ -0,0 +1,88 @@
+package handlers
+
+import (
+	"website/utils/database/models/cards"
+
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// PINData represents the JSON data structure for setting or removing the PIN of a card
+type PINData struct {
+	PIN     string `json:"pin"`
+	Current string `json:"current"`
+	Pours   bool   `json:"pours"`
+}
+
+// checkPIN verifies the PIN of a card, writing the error response when it is not correct
+func checkPIN(w http.ResponseWriter, r *http.Request, card *cards.Card, pin string) bool {
+	err := cards.CheckPIN(r.Context(), card, pin)
+	if errors.Is(err, cards.ErrPINRequired) {
+		http.Error(w, "Set a PIN on your card first", http.StatusForbidden)
+		return false
+	} else if errors.Is(err, cards.ErrWrongPIN) {
+		http.Error(w, "Wrong PIN", http.StatusUnauthorized)
+		return false
+	} else if errors.Is(err, cards.ErrPINLocked) {
+		http.Error(w, "Too many wrong PINs, try again later", http.StatusLocked)
+		return false
+	} else if errors.Is(err, mongo.ErrNoDocuments) {
+		http.Error(w, "Card does not exist", http.StatusNotFound)
+		return false
+	} else if err != nil {
+		http.Error(w, "Failed to check PIN", http.StatusInternalServerError)
+		return false
+	}
+	return true
+}
+
+// ClientSetPIN handles POST requests for setting, changing or removing the PIN of a card
+func ClientSetPIN(w http.ResponseWriter, r *http.Request) {
+	// Parse JSON data from the request body into pinData struct
+	var pinData PINData
+	if err := json.NewDecoder(r.Body).Decode(&pinData); err != nil {
+		http.Error(w, "Failed to decode JSON data", http.StatusBadRequest)
+		return
+	}
+
+	// Retrieve the card by its secret token
+	card, err := cards.GetByToken(r.Context(), mux.Vars(r)["token"])
+	if err != nil {
+		http.Error(w, "Failed to retrieve card", http.StatusNotFound)
+		return
+	}
+	if card.Blocked {
+		http.Error(w, "This card is blocked", http.StatusForbidden)
+		return
+	}
+
+	// Changing an existing PIN needs the current one
+	if card.HasPIN() && !checkPIN(w, r, card, pinData.Current) {
+		return
+	}
+
+	// Hash the new PIN, an empty PIN removes it
+	hash := ""
+	if pinData.PIN != "" {
+		hash, err = cards.HashPIN(pinData.PIN)
+		if errors.Is(err, cards.ErrInvalidPIN) {
+			http.Error(w, "A PIN must be 4 to 8 digits", http.StatusBadRequest)
+			return
+		} else if err != nil {
+			http.Error(w, "Failed to set PIN", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	// Save the PIN
+	if err := cards.SetPIN(r.Context(), card.ID, hash, pinData.Pours); err != nil {
+		http.Error(w, "Failed to set PIN", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
@@ -0,0 +1,216 @@
+package handlers
+
+import (
+	"website/utils/database/models/products"
+	"website/utils/money"
+
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// errNoProduct is returned when no product was chosen and there is no single product to fall back on
+var errNoProduct = errors.New("no product was chosen")
+
+// findProduct looks up an active product by its ID. When no ID is given and only one
+// product is for sale, that product is used.
+func findProduct(ctx context.Context, productID string) (*products.Product, error) {
+	// Fall back on the only product for sale
+	if productID == "" {
+		active, err := products.GetActive(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if len(active) != 1 {
+			return nil, errNoProduct
+		}
+		return &active[0], nil
+	}
+
+	// Convert hexadecimal string to primitive.ObjectID
+	objectID, err := primitive.ObjectIDFromHex(productID)
+	if err != nil {
+		return nil, errNoProduct
+	}
+
+	// Get the product, which must still be for sale
+	product, err := products.GetByID(ctx, objectID)
+	if errors.Is(err, mongo.ErrNoDocuments) || (err == nil && !product.Active) {
+		return nil, errNoProduct
+	}
+	return product, err
+}
+
+// parseProductForm reads the product fields present in a form into database updates
+func parseProductForm(r *http.Request) (bson.M, error) {
+	updates := bson.M{}
+
+	// Read the name
+	if name := strings.TrimSpace(r.FormValue("name")); name != "" {
+		updates["name"] = name
+	}
+
+	// Read the price in the configured currency
+	if value := r.FormValue("price"); value != "" {
+		price, err := money.Parse(value, getCurrency())
+		if err != nil {
+			return nil, err
+		}
+		if price.Amount <= 0 {
+			return nil, errors.New("price must be positive")
+		}
+		updates["price"] = price
+	}
+
+	// Read the tap, an empty value removes the product from its tap
+	if _, ok := r.Form["tap"]; ok {
+		updates["tap"] = strings.TrimSpace(r.FormValue("tap"))
+	}
+
+	// Read whether the product is for sale
+	if value := r.FormValue("active"); value != "" {
+		updates["active"] = value == "true" || value == "on" || value == "1"
+	}
+
+	return updates, nil
+}
+
+// OwnerProductsGet handles GET requests for listing all products
+func OwnerProductsGet(w http.ResponseWriter, r *http.Request) {
+	// Check the authentication
+	authHeader := r.Header.Get("Authorization")
+	if authHeader == "" {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	// Retrieve the products from the database
+	all, err := products.GetAll(r.Context())
+	if err != nil {
+		http.Error(w, "Failed to retrieve products", http.StatusInternalServerError)
+		return
+	}
+
+	// Return the products
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(all)
+}
+
+// OwnerProductsPost handles POST requests for adding a product
+func OwnerProductsPost(w http.ResponseWriter, r *http.Request) {
+	// Check the authentication
+	authHeader := r.Header.Get("Authorization")
+	if authHeader == "" {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	// Parse the form data
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Error parsing form data", http.StatusBadRequest)
+		return
+	}
+	updates, err := parseProductForm(r)
+	if err != nil {
+		http.Error(w, "Invalid price", http.StatusBadRequest)
+		return
+	}
+
+	// A new product needs at least a name and a price
+	name, hasName := updates["name"].(string)
+	price, hasPrice := updates["price"].(money.Money)
+	if !hasName || !hasPrice {
+		http.Error(w, "A product needs a name and a price", http.StatusBadRequest)
+		return
+	}
+	tap, _ := updates["tap"].(string)
+
+	// Insert the product into the database
+	product := products.New(name, price, tap)
+	if active, ok := updates["active"].(bool); ok {
+		product.Active = active
+	}
+	if _, err := products.Insert(r.Context(), &product); err != nil {
+		http.Error(w, "Failed to create product", http.StatusInternalServerError)
+		return
+	}
+
+	// Take the tap away from any other product
+	if tap != "" {
+		if err := products.ReleaseTap(r.Context(), tap, product.ID); err != nil {
+			http.Error(w, "Failed to assign tap", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	// Return the new product
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(product)
+}
+
+// OwnerProductPut handles PUT requests for changing a product
+func OwnerProductPut(w http.ResponseWriter, r *http.Request) {
+	// Check the authentication
+	authHeader := r.Header.Get("Authorization")
+	if authHeader == "" {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	// Convert the product ID from the URL path parameters to primitive.ObjectID
+	objectID, err := primitive.ObjectIDFromHex(mux.Vars(r)["product_id"])
+	if err != nil {
+		http.Error(w, "Invalid ID", http.StatusBadRequest)
+		return
+	}
+
+	// Parse the form data
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Error parsing form data", http.StatusBadRequest)
+		return
+	}
+	updates, err := parseProductForm(r)
+	if err != nil {
+		http.Error(w, "Invalid price", http.StatusBadRequest)
+		return
+	}
+
+	// Make sure the product exists
+	if _, err := products.GetByID(r.Context(), objectID); err != nil {
+		http.Error(w, "Could not fetch product", http.StatusNotFound)
+		return
+	}
+
+	// Take the tap away from any other product
+	if tap, ok := updates["tap"].(string); ok && tap != "" {
+		if err := products.ReleaseTap(r.Context(), tap, objectID); err != nil {
+			http.Error(w, "Failed to assign tap", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	// Update the product
+	if len(updates) > 0 {
+		if err := products.UpdateByID(r.Context(), objectID, updates); err != nil {
+			http.Error(w, "Failed to update product", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	// Return the updated product
+	product, err := products.GetByID(r.Context(), objectID)
+	if err != nil {
+		http.Error(w, "Could not fetch product", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(product)
+}
@@ -0,0 +1,36 @@
+package handlers
+
+import (
+	"website/internal/reconcile"
+
+	"encoding/json"
+	"net/http"
+)
+
+// OwnerReconcile handles GET requests for comparing orders with the payment provider and the card ledgers
+func OwnerReconcile(w http.ResponseWriter, r *http.Request) {
+	// Check the authentication
+	authHeader := r.Header.Get("Authorization")
+	if authHeader == "" {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	// Parse the period from the query parameters
+	from, to, err := reconcile.ParsePeriod(r.URL.Query().Get("from"), r.URL.Query().Get("to"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Reconcile the orders in the period
+	report, err := reconcile.Run(r.Context(), from, to)
+	if err != nil {
+		http.Error(w, "Failed to reconcile orders", http.StatusInternalServerError)
+		return
+	}
+
+	// Return the report
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(report)
+}
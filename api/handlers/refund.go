@@ -0,0 +1,73 @@
+package handlers
+
+import (
+	"website/internal/payment"
+	"website/internal/settlement"
+	"website/utils/database/models/orders"
+
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// OwnerRefund handles POST requests for refunding a paid order, fully or for a number of beers.
+// Repeating the request after a failure finishes the refund that was started.
+func OwnerRefund(w http.ResponseWriter, r *http.Request) {
+	// Check the authentication
+	authHeader := r.Header.Get("Authorization")
+	if authHeader == "" {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	// Convert the order ID from the URL path parameters to primitive.ObjectID
+	objectID, err := primitive.ObjectIDFromHex(mux.Vars(r)["order_id"])
+	if err != nil {
+		http.Error(w, "Invalid ID", http.StatusBadRequest)
+		return
+	}
+
+	// Parse the number of beers to refund, leaving it out refunds everything that is left
+	var beers uint64
+	if value := r.FormValue("beers"); value != "" {
+		beers, err = strconv.ParseUint(value, 10, 32)
+		if err != nil || beers == 0 {
+			http.Error(w, "Invalid number of beers", http.StatusBadRequest)
+			return
+		}
+	}
+
+	// Refund the order
+	result, err := settlement.Refund(r.Context(), objectID, uint(beers))
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		http.Error(w, "Could not fetch order", http.StatusNotFound)
+		return
+	} else if errors.Is(err, orders.ErrInvalidTransition) || errors.Is(err, orders.ErrAlreadyProcessed) {
+		http.Error(w, "Only paid orders can be refunded", http.StatusConflict)
+		return
+	} else if errors.Is(err, settlement.ErrRefundInProgress) {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	} else if errors.Is(err, settlement.ErrInvalidRefund) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	} else if errors.Is(err, payment.ErrNotSupported) {
+		http.Error(w, "The payment provider does not support refunds", http.StatusNotImplemented)
+		return
+	} else if errors.Is(err, payment.ErrDeclined) {
+		http.Error(w, "The payment provider declined the refund", http.StatusBadGateway)
+		return
+	} else if err != nil {
+		http.Error(w, "Failed to refund order, try again to finish the refund", http.StatusInternalServerError)
+		return
+	}
+
+	// Return what was refunded
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
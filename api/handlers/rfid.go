@@ -0,0 +1,194 @@
+package handlers
+
+import (
+	"website/internal/pairing"
+	"website/utils/database/models/cards"
+
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// ScanData represents the JSON data structure for tags scanned at the tap
+type ScanData struct {
+	UID string `json:"uid"`
+	Tap string `json:"tap"`
+}
+
+// ScanResponse represents the JSON data structure returned to the tap after a scan
+type ScanResponse struct {
+	Paired   bool   `json:"paired"`
+	ServerID uint64 `json:"server_id"`
+}
+
+// PairingResponse represents the state of pairing tags with cards
+type PairingResponse struct {
+	Current *pairing.Session `json:"current"`
+	Last    *pairing.Result  `json:"last"`
+}
+
+// bindUID binds a tag to a card, writing the error response when that fails
+func bindUID(w http.ResponseWriter, r *http.Request, card *cards.Card, uid string) bool {
+	err := cards.BindUID(r.Context(), card.ID, uid)
+	if errors.Is(err, cards.ErrUIDInUse) {
+		http.Error(w, "The tag is already bound to another card", http.StatusConflict)
+		return false
+	} else if err != nil {
+		http.Error(w, "Failed to bind the tag", http.StatusInternalServerError)
+		return false
+	}
+	return true
+}
+
+// TapScan handles POST requests from the tap reporting a scanned tag. While the owner is
+// pairing, the tag is bound to the card being paired; otherwise the card of the tag is returned.
+func TapScan(w http.ResponseWriter, r *http.Request) {
+	// Parse JSON data from the request body into scanData struct
+	var scanData ScanData
+	if err := json.NewDecoder(r.Body).Decode(&scanData); err != nil {
+		http.Error(w, "Failed to decode JSON data", http.StatusBadRequest)
+		return
+	}
+	uid := cards.NormalizeUID(scanData.UID)
+	if uid == "" {
+		http.Error(w, "Invalid UID", http.StatusBadRequest)
+		return
+	}
+
+	// Bind the tag when the owner is pairing
+	if session := pairing.Take(); session != nil {
+		result := pairing.Result{ServerID: session.ServerID, UID: uid}
+		card, err := cards.GetByServerID(r.Context(), session.ServerID)
+		if err != nil {
+			result.Error = "card not found"
+			pairing.Finish(result)
+			http.Error(w, "Card being paired does not exist", http.StatusNotFound)
+			return
+		}
+		if !bindUID(w, r, card, uid) {
+			result.Error = "tag could not be bound"
+			pairing.Finish(result)
+			return
+		}
+		pairing.Finish(result)
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(ScanResponse{Paired: true, ServerID: card.ServerID})
+		return
+	}
+
+	// Otherwise look up the card of the tag
+	card, err := cards.GetByUID(r.Context(), uid)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		http.Error(w, "Tag is not bound to a card", http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, "Failed to retrieve card", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(ScanResponse{Paired: false, ServerID: card.ServerID})
+}
+
+// OwnerCardBindUID handles PUT requests for binding a known tag to a card
+func OwnerCardBindUID(w http.ResponseWriter, r *http.Request) {
+	// Check the authentication
+	authHeader := r.Header.Get("Authorization")
+	if authHeader == "" {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	// Parse the UID of the tag
+	uid := cards.NormalizeUID(r.FormValue("uid"))
+	if uid == "" {
+		http.Error(w, "Invalid UID", http.StatusBadRequest)
+		return
+	}
+
+	// Fetch the card and bind the tag
+	card, ok := getCardByServerID(w, r)
+	if !ok {
+		return
+	}
+	if !bindUID(w, r, card, uid) {
+		return
+	}
+
+	// Return the updated card
+	card.UID = uid
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(card)
+}
+
+// OwnerCardUnbindUID handles DELETE requests for removing the tag from a card
+func OwnerCardUnbindUID(w http.ResponseWriter, r *http.Request) {
+	// Check the authentication
+	authHeader := r.Header.Get("Authorization")
+	if authHeader == "" {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	// Fetch the card and remove its tag
+	card, ok := getCardByServerID(w, r)
+	if !ok {
+		return
+	}
+	if err := cards.UnbindUID(r.Context(), card.ID); err != nil {
+		http.Error(w, "Failed to remove the tag", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// OwnerCardPair handles POST requests for binding the next tag scanned at the tap to a card
+func OwnerCardPair(w http.ResponseWriter, r *http.Request) {
+	// Check the authentication
+	authHeader := r.Header.Get("Authorization")
+	if authHeader == "" {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	// Fetch the card and wait for its tag
+	card, ok := getCardByServerID(w, r)
+	if !ok {
+		return
+	}
+	session := pairing.Start(card.ServerID, pairing.DefaultTimeout)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(session)
+}
+
+// OwnerPairingGet handles GET requests for following the pairing of a tag
+func OwnerPairingGet(w http.ResponseWriter, r *http.Request) {
+	// Check the authentication
+	authHeader := r.Header.Get("Authorization")
+	if authHeader == "" {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(PairingResponse{Current: pairing.Current(), Last: pairing.Last()})
+}
+
+// OwnerPairingDelete handles DELETE requests for stopping the pairing of a tag
+func OwnerPairingDelete(w http.ResponseWriter, r *http.Request) {
+	// Check the authentication
+	authHeader := r.Header.Get("Authorization")
+	if authHeader == "" {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	pairing.Cancel()
+	w.WriteHeader(http.StatusNoContent)
+}
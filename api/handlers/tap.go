@@ -0,0 +1,125 @@
+package handlers
+
+import (
+	"website/internal/settlement"
+	"website/utils/database/models/cards"
+	"website/utils/database/models/products"
+
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// PourData represents the JSON data structure for pour requests from the tap.
+// The card is identified by the UID of its tag, or by its server ID when no UID is given.
+// The PIN is only checked for cards that require it for pours.
+type PourData struct {
+	ID  string `json:"server_id"`
+	UID string `json:"uid"`
+	Tap string `json:"tap"`
+	PIN string `json:"pin"`
+}
+
+// PourResponse represents the JSON data structure returned to the tap after a pour request.
+type PourResponse struct {
+	Poured bool `json:"poured"`
+	Beers  uint `json:"beers"`
+}
+
+// writePourResponse writes the outcome of a pour request as JSON
+func writePourResponse(w http.ResponseWriter, status int, response PourResponse) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(response)
+}
+
+// TapPour handles POST requests from the tap for pouring a beer from a card
+func TapPour(w http.ResponseWriter, r *http.Request) {
+	// Parse JSON data from the request body into pourData struct
+	var pourData PourData
+	if err := json.NewDecoder(r.Body).Decode(&pourData); err != nil {
+		http.Error(w, "Failed to decode JSON data", http.StatusBadRequest)
+		return
+	}
+
+	// Find the card from its tag, or from the server ID in the pour data
+	var card *cards.Card
+	var err error
+	if pourData.UID != "" {
+		card, err = cards.GetByUID(r.Context(), pourData.UID)
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			http.Error(w, "Tag is not bound to a card", http.StatusNotFound)
+			return
+		}
+	} else {
+		id, parseErr := strconv.ParseUint(pourData.ID, 10, 64)
+		if parseErr != nil {
+			http.Error(w, fmt.Sprintf("Invalid server ID: %v", parseErr), http.StatusBadRequest)
+			return
+		}
+		card, err = cards.GetByServerID(r.Context(), id)
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			http.Error(w, "Card does not exist", http.StatusNotFound)
+			return
+		}
+	}
+	if err != nil {
+		http.Error(w, "Failed to retrieve card", http.StatusInternalServerError)
+		return
+	}
+
+	// Find the product served by the tap, falling back on the only product for sale
+	product, err := products.GetByTap(r.Context(), pourData.Tap)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		product, err = findProduct(r.Context(), "")
+	}
+	if errors.Is(err, errNoProduct) {
+		http.Error(w, "No product is assigned to this tap", http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, "Failed to retrieve product", http.StatusInternalServerError)
+		return
+	}
+
+	// Check the PIN when the customer wants one for every pour
+	if card.PINForPours {
+		if err := cards.CheckPIN(r.Context(), card, pourData.PIN); err != nil {
+			if errors.Is(err, mongo.ErrNoDocuments) {
+				http.Error(w, "Card does not exist", http.StatusNotFound)
+				return
+			}
+			status := http.StatusUnauthorized
+			if errors.Is(err, cards.ErrPINLocked) {
+				status = http.StatusLocked
+			} else if !errors.Is(err, cards.ErrWrongPIN) {
+				http.Error(w, "Failed to check PIN", http.StatusInternalServerError)
+				return
+			}
+			writePourResponse(w, status, PourResponse{Poured: false, Beers: 0})
+			return
+		}
+	}
+
+	// Take a beer from the card, recording the pour in the same transaction
+	card, err = settlement.Pour(r.Context(), card.ServerID, product.ID, pourData.Tap)
+	if errors.Is(err, cards.ErrNoBeers) {
+		writePourResponse(w, http.StatusPaymentRequired, PourResponse{Poured: false, Beers: 0})
+		return
+	} else if errors.Is(err, cards.ErrBlocked) {
+		writePourResponse(w, http.StatusForbidden, PourResponse{Poured: false, Beers: 0})
+		return
+	} else if errors.Is(err, mongo.ErrNoDocuments) {
+		http.Error(w, "Card does not exist", http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, "Failed to pour from card", http.StatusInternalServerError)
+		return
+	}
+
+	// Return the remaining balance to the tap
+	writePourResponse(w, http.StatusOK, PourResponse{Poured: true, Beers: card.Balance(product.ID)})
+}
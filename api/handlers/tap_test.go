@@ -0,0 +1,83 @@
+package handlers
+
+import (
+	"website/utils/database"
+	"website/utils/database/models/cards"
+	"website/utils/database/models/products"
+	"website/utils/money"
+
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// TestTapPourWithoutTap pours from a tap that does not send its name. Only the single product
+// for sale may be poured then, never a product that happens to have no tap. It needs a MongoDB
+// replica set, given by MONGO_TEST_URI, because pours use transactions.
+func TestTapPourWithoutTap(t *testing.T) {
+	uri := os.Getenv("MONGO_TEST_URI")
+	if uri == "" {
+		t.Skip("MONGO_TEST_URI is not set")
+	}
+	ctx := context.Background()
+
+	// Connect to a database of its own, dropped afterwards
+	name := fmt.Sprintf("handlerstest_%d", time.Now().UnixNano())
+	if err := database.Connect(uri, name); err != nil {
+		t.Fatal(err)
+	}
+	defer database.Disconnect()
+	defer database.GetCollection("cards").Database().Drop(ctx)
+
+	// Create a card holding two beers of a product without a tap
+	bottled := products.New("Bottled", money.New(300, "EUR"), "")
+	if _, err := products.Insert(ctx, &bottled); err != nil {
+		t.Fatal(err)
+	}
+	card, err := cards.NewWithServerID(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	card.ID = primitive.NewObjectID()
+	if err := cards.Insert(ctx, &card); err != nil {
+		t.Fatal(err)
+	}
+	if err := cards.Credit(ctx, card.ID, bottled.ID, 2); err != nil {
+		t.Fatal(err)
+	}
+
+	// pour sends a pour without a tap and checks the status and the balance left
+	pour := func(status int, want uint) {
+		t.Helper()
+		request := httptest.NewRequest(http.MethodPost, "/tap/pour", strings.NewReader(`{"server_id": "1"}`))
+		recorder := httptest.NewRecorder()
+		TapPour(recorder, request)
+		if recorder.Code != status {
+			t.Fatalf("pour returned status %d, want %d: %s", recorder.Code, status, recorder.Body)
+		}
+		poured, err := cards.GetByID(ctx, card.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if beers := poured.Balance(bottled.ID); beers != want {
+			t.Errorf("balance = %d, want %d", beers, want)
+		}
+	}
+
+	// With a single product for sale, that product is poured
+	pour(http.StatusOK, 1)
+
+	// With a second product on a tap, there is nothing to fall back on
+	draught := products.New("Draught", money.New(250, "EUR"), "1")
+	if _, err := products.Insert(ctx, &draught); err != nil {
+		t.Fatal(err)
+	}
+	pour(http.StatusNotFound, 1)
+}
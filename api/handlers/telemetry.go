@@ -0,0 +1,79 @@
+package handlers
+
+import (
+	"website/utils/database/models/telemetry"
+
+	"encoding/json"
+	"net/http"
+	"time"
+)
+
+// telemetryPoints is roughly how many points a telemetry series is combined into
+const telemetryPoints = 100
+
+// telemetryPeriods are the named periods the owner can ask the history of
+var telemetryPeriods = map[string]time.Duration{
+	"day":  24 * time.Hour,
+	"week": 7 * 24 * time.Hour,
+}
+
+// OwnerTelemetryGet handles GET requests for the level of the taps over a period. The period is
+// either named with "period" (day or week, the last day by default) or given with "from" and "to".
+func OwnerTelemetryGet(w http.ResponseWriter, r *http.Request) {
+	// Check the authentication
+	authHeader := r.Header.Get("Authorization")
+	if authHeader == "" {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	// Parse the period, ending now by default
+	query := r.URL.Query()
+	to := time.Now()
+	from := to.Add(-telemetryPeriods["day"])
+	if value := query.Get("period"); value != "" {
+		period, ok := telemetryPeriods[value]
+		if !ok {
+			http.Error(w, "Invalid period", http.StatusBadRequest)
+			return
+		}
+		from = to.Add(-period)
+	}
+	if value := query.Get("from"); value != "" {
+		parsed, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			http.Error(w, "Invalid from", http.StatusBadRequest)
+			return
+		}
+		from = parsed
+	}
+	if value := query.Get("to"); value != "" {
+		parsed, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			http.Error(w, "Invalid to", http.StatusBadRequest)
+			return
+		}
+		to = parsed
+	}
+	if !from.Before(to) {
+		http.Error(w, "The period must end after it starts", http.StatusBadRequest)
+		return
+	}
+
+	// Combine the buckets into a readable number of points
+	step := (to.Sub(from) / telemetryPoints).Truncate(telemetry.BucketSize)
+	if step < telemetry.BucketSize {
+		step = telemetry.BucketSize
+	}
+
+	// Retrieve the series from the database
+	points, err := telemetry.Series(r.Context(), query.Get("tap"), from, to, step)
+	if err != nil {
+		http.Error(w, "Failed to retrieve telemetry", http.StatusInternalServerError)
+		return
+	}
+
+	// Return the series
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(points)
+}
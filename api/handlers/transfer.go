@@ -0,0 +1,95 @@
+package handlers
+
+import (
+	"website/internal/settlement"
+	"website/utils/database/models/cards"
+
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// TransferData represents the JSON data structure for transferring beers to another card
+type TransferData struct {
+	To      string `json:"to"`
+	Product string `json:"product"`
+	Beers   string `json:"beers"`
+	PIN     string `json:"pin"`
+}
+
+// ClientTransfer handles POST requests for giving beers from one card to another
+func ClientTransfer(w http.ResponseWriter, r *http.Request) {
+	// Parse JSON data from the request body into transferData struct
+	var transferData TransferData
+	if err := json.NewDecoder(r.Body).Decode(&transferData); err != nil {
+		http.Error(w, "Failed to decode JSON data", http.StatusBadRequest)
+		return
+	}
+
+	// Parse the target server ID and the number of beers
+	toID, err := strconv.ParseUint(transferData.To, 10, 64)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid target card: %v", err), http.StatusBadRequest)
+		return
+	}
+	beers, err := strconv.ParseUint(transferData.Beers, 10, 32)
+	if err != nil || beers == 0 {
+		http.Error(w, "Invalid number of beers", http.StatusBadRequest)
+		return
+	}
+
+	// Retrieve the source card by its secret token, which proves the sender owns it
+	from, err := cards.GetByToken(r.Context(), mux.Vars(r)["token"])
+	if err != nil {
+		http.Error(w, "Failed to retrieve card", http.StatusNotFound)
+		return
+	}
+
+	// Beers only leave a card protected with a PIN when the PIN is given
+	if from.HasPIN() && !checkPIN(w, r, from, transferData.PIN) {
+		return
+	}
+
+	// Retrieve the target card
+	to, err := cards.GetByServerID(r.Context(), toID)
+	if err != nil {
+		http.Error(w, "Target card does not exist", http.StatusNotFound)
+		return
+	}
+
+	// Fetch the product to transfer
+	product, err := findProduct(r.Context(), transferData.Product)
+	if errors.Is(err, errNoProduct) {
+		http.Error(w, "Invalid product", http.StatusBadRequest)
+		return
+	} else if err != nil {
+		http.Error(w, "Could not fetch product", http.StatusInternalServerError)
+		return
+	}
+
+	// Move the beers
+	err = settlement.Transfer(r.Context(), from.ID, to.ID, product.ID, uint(beers))
+	if errors.Is(err, cards.ErrNoBeers) {
+		http.Error(w, "Not enough beers on the card", http.StatusConflict)
+		return
+	} else if errors.Is(err, cards.ErrBlocked) {
+		http.Error(w, "This card is blocked", http.StatusForbidden)
+		return
+	} else if errors.Is(err, settlement.ErrSameCard) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	} else if errors.Is(err, mongo.ErrNoDocuments) {
+		http.Error(w, "Target card does not exist", http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, "Failed to transfer beers", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
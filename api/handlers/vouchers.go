@@ -0,0 +1,175 @@
+package handlers
+
+import (
+	"website/internal/settlement"
+	"website/utils/database/models/cards"
+	"website/utils/database/models/products"
+	"website/utils/database/models/vouchers"
+
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// maxVoucherBatch limits how many vouchers can be generated at once
+const maxVoucherBatch = 500
+
+// VoucherData represents the JSON data structure for redeeming a voucher
+type VoucherData struct {
+	Code string `json:"code"`
+}
+
+// VoucherBatchResponse represents a batch of generated vouchers
+type VoucherBatchResponse struct {
+	Batch    string             `json:"batch"`
+	Vouchers []vouchers.Voucher `json:"vouchers"`
+}
+
+// OwnerVouchersPost handles POST requests for generating a batch of vouchers
+func OwnerVouchersPost(w http.ResponseWriter, r *http.Request) {
+	// Check the authentication
+	authHeader := r.Header.Get("Authorization")
+	if authHeader == "" {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	// Parse how many vouchers to generate
+	count, err := strconv.ParseUint(r.FormValue("count"), 10, 32)
+	if err != nil || count == 0 || count > maxVoucherBatch {
+		http.Error(w, "Invalid count", http.StatusBadRequest)
+		return
+	}
+
+	// Parse how many drinks every voucher is worth
+	beers, err := strconv.ParseUint(r.FormValue("beers"), 10, 32)
+	if err != nil || beers == 0 {
+		http.Error(w, "Invalid number of beers", http.StatusBadRequest)
+		return
+	}
+
+	// Parse how many cards can redeem every voucher, single-use by default
+	maxUses := uint64(1)
+	if value := r.FormValue("max_uses"); value != "" {
+		maxUses, err = strconv.ParseUint(value, 10, 32)
+		if err != nil || maxUses == 0 {
+			http.Error(w, "Invalid maximum number of uses", http.StatusBadRequest)
+			return
+		}
+	}
+
+	// Parse the last day the vouchers can be used, they never expire by default
+	var expiresAt *time.Time
+	if value := r.FormValue("expires"); value != "" {
+		day, err := time.ParseInLocation("2006-01-02", value, time.Local)
+		if err != nil {
+			http.Error(w, "Invalid expiry date", http.StatusBadRequest)
+			return
+		}
+		end := day.AddDate(0, 0, 1)
+		expiresAt = &end
+	}
+
+	// Fetch the product the vouchers are for
+	product, err := findProduct(r.Context(), r.FormValue("product"))
+	if errors.Is(err, errNoProduct) {
+		http.Error(w, "Invalid product", http.StatusBadRequest)
+		return
+	} else if err != nil {
+		http.Error(w, "Could not fetch product", http.StatusInternalServerError)
+		return
+	}
+
+	// Generate the vouchers
+	batch := primitive.NewObjectID().Hex()
+	generated := make([]vouchers.Voucher, count)
+	for i := range generated {
+		generated[i], err = vouchers.New(batch, product.ID, uint(beers), uint(maxUses), expiresAt)
+		if err != nil {
+			http.Error(w, "Failed to generate vouchers", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	// Insert the vouchers into the database
+	if err := vouchers.InsertMany(r.Context(), generated); err != nil {
+		http.Error(w, "Failed to save vouchers", http.StatusInternalServerError)
+		return
+	}
+
+	// Return the batch
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(VoucherBatchResponse{Batch: batch, Vouchers: generated})
+}
+
+// OwnerVouchersGet handles GET requests for listing a batch of vouchers
+func OwnerVouchersGet(w http.ResponseWriter, r *http.Request) {
+	// Check the authentication
+	authHeader := r.Header.Get("Authorization")
+	if authHeader == "" {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	// Retrieve the vouchers of the batch
+	batch := r.URL.Query().Get("batch")
+	found, err := vouchers.GetByBatch(r.Context(), batch)
+	if err != nil {
+		http.Error(w, "Failed to retrieve vouchers", http.StatusInternalServerError)
+		return
+	}
+
+	// Return the batch
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(VoucherBatchResponse{Batch: batch, Vouchers: found})
+}
+
+// ClientRedeemVoucher handles POST requests for redeeming a voucher onto a card
+func ClientRedeemVoucher(w http.ResponseWriter, r *http.Request) {
+	// Parse JSON data from the request body into voucherData struct
+	var voucherData VoucherData
+	if err := json.NewDecoder(r.Body).Decode(&voucherData); err != nil {
+		http.Error(w, "Failed to decode JSON data", http.StatusBadRequest)
+		return
+	}
+
+	// Retrieve card information from the database by its secret token
+	card, err := cards.GetByToken(r.Context(), mux.Vars(r)["token"])
+	if err != nil {
+		http.Error(w, "Failed to retrieve card", http.StatusNotFound)
+		return
+	}
+	if card.Blocked {
+		http.Error(w, "This card is blocked", http.StatusForbidden)
+		return
+	}
+
+	// Redeem the voucher onto the card
+	voucher, err := settlement.RedeemVoucher(r.Context(), voucherData.Code, card.ID)
+	if errors.Is(err, vouchers.ErrNotRedeemable) {
+		http.Error(w, "This code is invalid, expired or already used", http.StatusBadRequest)
+		return
+	} else if errors.Is(err, cards.ErrVoucherLocked) {
+		http.Error(w, "Too many invalid codes, try again later", http.StatusLocked)
+		return
+	} else if err != nil {
+		http.Error(w, "Failed to redeem voucher", http.StatusInternalServerError)
+		return
+	}
+
+	// Look up the name of the product for the customer
+	name := ""
+	if product, err := products.GetByID(r.Context(), voucher.ProductID); err == nil {
+		name = product.Name
+	}
+
+	// Return what was added to the card
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"product": name, "beers": voucher.Beers})
+}
@@ -14,5 +14,8 @@ func ConfigureClientRoutes(router *mux.Router) {
     clientRouter := router.PathPrefix("/client").Subrouter()
 
     // Define routes for client-related endpoints
-	clientRouter.HandleFunc("/{server_id}", handlers.ClientGet).Methods(http.MethodGet)
+	clientRouter.HandleFunc("/{token}", handlers.ClientGet).Methods(http.MethodGet)
+	clientRouter.HandleFunc("/{token}/voucher", handlers.ClientRedeemVoucher).Methods(http.MethodPost)
+	clientRouter.HandleFunc("/{token}/transfer", handlers.ClientTransfer).Methods(http.MethodPost)
+	clientRouter.HandleFunc("/{token}/pin", handlers.ClientSetPIN).Methods(http.MethodPost)
 }
@@ -21,4 +21,29 @@ func ConfigureOwnerRoutes(router *mux.Router) {
 	ownerRouter.HandleFunc("", handlers.OwnerGet).Methods(http.MethodGet)
 	ownerRouter.HandleFunc("", handlers.OwnerLogin).Methods(http.MethodPost)
 	ownerRouter.HandleFunc("", handlers.OwnerPut).Methods(http.MethodPut)
+	ownerRouter.HandleFunc("/cards", handlers.OwnerCardsGet).Methods(http.MethodGet)
+	ownerRouter.HandleFunc("/cards", handlers.OwnerCardsPost).Methods(http.MethodPost)
+	ownerRouter.HandleFunc("/cards/manage", handlers.OwnerCardsPage).Methods(http.MethodGet)
+	ownerRouter.HandleFunc("/cards/sheet", handlers.OwnerCardsSheet).Methods(http.MethodGet)
+	ownerRouter.HandleFunc("/cards/pairing", handlers.OwnerPairingGet).Methods(http.MethodGet)
+	ownerRouter.HandleFunc("/cards/pairing", handlers.OwnerPairingDelete).Methods(http.MethodDelete)
+	ownerRouter.HandleFunc("/cards/{server_id}", handlers.OwnerCardDelete).Methods(http.MethodDelete)
+	ownerRouter.HandleFunc("/cards/{server_id}/adjust", handlers.OwnerCardAdjust).Methods(http.MethodPost)
+	ownerRouter.HandleFunc("/cards/{server_id}/block", handlers.OwnerCardBlock).Methods(http.MethodPost)
+	ownerRouter.HandleFunc("/cards/{server_id}/move", handlers.OwnerCardMove).Methods(http.MethodPost)
+	ownerRouter.HandleFunc("/cards/{server_id}/uid", handlers.OwnerCardBindUID).Methods(http.MethodPut)
+	ownerRouter.HandleFunc("/cards/{server_id}/uid", handlers.OwnerCardUnbindUID).Methods(http.MethodDelete)
+	ownerRouter.HandleFunc("/cards/{server_id}/pair", handlers.OwnerCardPair).Methods(http.MethodPost)
+	ownerRouter.HandleFunc("/cards/{server_id}/ledger", handlers.OwnerCardLedger).Methods(http.MethodGet)
+	ownerRouter.HandleFunc("/products", handlers.OwnerProductsGet).Methods(http.MethodGet)
+	ownerRouter.HandleFunc("/products", handlers.OwnerProductsPost).Methods(http.MethodPost)
+	ownerRouter.HandleFunc("/products/{product_id}", handlers.OwnerProductPut).Methods(http.MethodPut)
+	ownerRouter.HandleFunc("/vouchers", handlers.OwnerVouchersGet).Methods(http.MethodGet)
+	ownerRouter.HandleFunc("/vouchers", handlers.OwnerVouchersPost).Methods(http.MethodPost)
+	ownerRouter.HandleFunc("/orders/{order_id}/refund", handlers.OwnerRefund).Methods(http.MethodPost)
+	ownerRouter.HandleFunc("/kegs", handlers.OwnerKegsGet).Methods(http.MethodGet)
+	ownerRouter.HandleFunc("/kegs", handlers.OwnerKegsPost).Methods(http.MethodPost)
+	ownerRouter.HandleFunc("/kegs/{keg_id}/untap", handlers.OwnerKegUntap).Methods(http.MethodPost)
+	ownerRouter.HandleFunc("/telemetry", handlers.OwnerTelemetryGet).Methods(http.MethodGet)
+	ownerRouter.HandleFunc("/reconcile", handlers.OwnerReconcile).Methods(http.MethodGet)
 }
@@ -17,10 +17,11 @@ func CreateAPIRouter() http.Handler {
 	fileServer := http.FileServer(http.Dir("web/static"))
 	router.PathPrefix("/static/").Handler(http.StripPrefix("/static/", fileServer))
 
-	// Configure client, owner, order, and payment routes.
+	// Configure client, owner, order, payment, and tap routes.
 	ConfigureClientRoutes(router)
 	ConfigureOwnerRoutes(router)
 	ConfigureOrderRoutes(router)
+	ConfigureTapRoutes(router)
 
 	return router
 }
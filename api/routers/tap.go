@@ -0,0 +1,24 @@
+package routers
+
+import (
+	"website/api/handlers"
+	"website/internal/middleware"
+
+	"net/http"
+
+	"github.com/gorilla/mux"
+)
+
+// ConfigureTapRoutes sets up tap-related routes on a provided Gorilla Mux router
+func ConfigureTapRoutes(router *mux.Router) {
+	// Create a subrouter for tap-related routes under the "/tap" path
+	tapRouter := router.PathPrefix("/tap").Subrouter()
+
+	// Only allow requests from the tap itself
+	tapRouter.Use(middleware.TapAuthenticationMiddleware)
+
+	// Define routes for tap-related endpoints
+	tapRouter.HandleFunc("/pour", handlers.TapPour).Methods(http.MethodPost)
+	tapRouter.HandleFunc("/scan", handlers.TapScan).Methods(http.MethodPost)
+	tapRouter.HandleFunc("/weight", handlers.TapWeight).Methods(http.MethodPost)
+}
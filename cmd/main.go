@@ -13,6 +13,11 @@ import (
 )
 
 func main() {
+	// Run a subcommand instead of the server when one was given
+	if len(os.Args) > 1 && os.Args[1] == "reconcile" {
+		os.Exit(runReconcile(os.Args[2:]))
+	}
+
 	// Initialize the application
     if err := app.Initialize("./"); err != nil {
         log.Fatalf("[Error] %v", err)
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"website/internal/app"
+	"website/internal/reconcile"
+
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+)
+
+// runReconcile implements the "reconcile" subcommand, printing a reconciliation report as JSON.
+// It returns the exit code of the program.
+func runReconcile(args []string) int {
+	// Parse the command line flags
+	flags := flag.NewFlagSet("reconcile", flag.ContinueOnError)
+	from := flags.String("from", "", "first day to reconcile (YYYY-MM-DD), defaults to a week before -to")
+	to := flags.String("to", "", "last day to reconcile (YYYY-MM-DD), defaults to today")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	// Parse the period
+	start, end, err := reconcile.ParsePeriod(*from, *to)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "[Error] %v\n", err)
+		return 2
+	}
+
+	// Initialize the configuration, payment provider and database
+	if err := app.InitializeCommand("./"); err != nil {
+		fmt.Fprintf(os.Stderr, "[Error] %v\n", err)
+		return 1
+	}
+	defer app.Clean(nil)
+
+	// Reconcile the orders in the period
+	report, err := reconcile.Run(context.Background(), start, end)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "[Error] failed to reconcile orders: %v\n", err)
+		return 1
+	}
+
+	// Print the report
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(report); err != nil {
+		return 1
+	}
+
+	// Signal mismatches through the exit code so scripts can act on them
+	if len(report.Findings) > 0 {
+		return 3
+	}
+	return 0
+}
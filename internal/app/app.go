@@ -1,19 +1,31 @@
 package app
 
 import (
+	"website/internal/expiry"
+	"website/internal/jobs"
 	"website/internal/password"
+	"website/internal/payment"
+	"website/internal/payment/fakepay"
+	"website/internal/payment/mollie"
+	"website/internal/pricing"
 	"website/web/templates"
 	"website/utils/database"
 	"website/utils/database/models/cards"
+	"website/utils/database/models/ledger"
+	"website/utils/database/models/orders"
+	"website/utils/database/models/products"
+	"website/utils/money"
 
 	"fmt"
 	"os"
 	"context"
 	"net/http"
 	"log"
+	"strconv"
 	"time"
 
 	"github.com/joho/godotenv"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
 // initAdminCard initializes an admin (testing) card for the backend if it doesn't already exist.
@@ -22,13 +34,12 @@ func initAdminCard() error {
 	card, err := cards.GetByServerID(context.TODO(), 0)
 	if card == nil && err != nil {
 		// Initialize the admin card
-		card, err := cards.New(context.TODO())
+		card, err := cards.NewWithServerID(0)
 		if err != nil {
 			return fmt.Errorf("failed to create a new admin card: %v", err)
 		}
 
 		// Insert the admin card into the database
-		card.ServerID = 0
 		err = cards.Insert(context.TODO(), &card)
 		if err != nil {
 			return fmt.Errorf("failed to insert the admin card into the database: %v", err)
@@ -38,6 +49,164 @@ func initAdminCard() error {
 	return nil
 }
 
+// initProducts creates the first product from the PRICE environment variable when there are
+// no products yet, and moves data from before products existed onto the oldest product.
+func initProducts() error {
+	all, err := products.GetAll(context.TODO())
+	if err != nil {
+		return fmt.Errorf("failed to retrieve the products: %v", err)
+	}
+
+	// Create the first product
+	if len(all) == 0 {
+		currency := os.Getenv("CURRENCY")
+		if currency == "" {
+			currency = "EUR"
+		}
+		price, err := money.Parse(os.Getenv("PRICE"), currency)
+		if err != nil {
+			return fmt.Errorf("failed to parse PRICE for the first product: %v", err)
+		}
+		if price.Amount <= 0 {
+			return fmt.Errorf("PRICE for the first product must be positive")
+		}
+
+		product := products.New("Beer", price, "")
+		if _, err := products.Insert(context.TODO(), &product); err != nil {
+			return fmt.Errorf("failed to insert the first product: %v", err)
+		}
+		all = append(all, product)
+	}
+
+	// Move single beer counters, orders and ledger entries onto the oldest product
+	if err := cards.MigrateBeers(context.TODO(), all[0].ID); err != nil {
+		return fmt.Errorf("failed to migrate card balances: %v", err)
+	}
+	if err := orders.MigrateProduct(context.TODO(), all[0].ID); err != nil {
+		return fmt.Errorf("failed to migrate orders: %v", err)
+	}
+	if err := ledger.MigrateProduct(context.TODO(), all[0].ID); err != nil {
+		return fmt.Errorf("failed to migrate the ledger: %v", err)
+	}
+
+	return nil
+}
+
+// initLedger opens the history of cards that had a balance before the ledger existed.
+func initLedger() error {
+	allCards, err := cards.GetAll(context.TODO())
+	if err != nil {
+		return fmt.Errorf("failed to retrieve the cards: %v", err)
+	}
+
+	for _, card := range allCards {
+		// Only cards without any history need an opening entry
+		count, err := ledger.Count(context.TODO(), card.ID)
+		if err != nil {
+			return fmt.Errorf("failed to count the ledger of card %d: %v", card.ServerID, err)
+		}
+		if count > 0 {
+			continue
+		}
+
+		// Record the existing balances as the start of the history
+		for product, beers := range card.Balances {
+			productID, err := primitive.ObjectIDFromHex(product)
+			if err != nil || beers == 0 {
+				continue
+			}
+			entry := ledger.NewCredit(card.ID, productID, ledger.ReasonOpening, beers, "")
+			if _, err := ledger.Insert(context.TODO(), &entry); err != nil {
+				return fmt.Errorf("failed to open the ledger of card %d: %v", card.ServerID, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// initPaymentProvider selects the payment provider configured by PAYMENT_PROVIDER.
+func initPaymentProvider() error {
+	// Development falls back to fakepay when no provider was chosen
+	name := os.Getenv("PAYMENT_PROVIDER")
+	if name == "" && os.Getenv("ENVIRONMENT") != "production" {
+		name = "fakepay"
+	}
+
+	switch name {
+	case "fakepay":
+		payment.Use(fakepay.New(
+			os.Getenv("PAYMENT_GATE_URL"),
+			os.Getenv("PAYMENT_GATE_KEY"),
+			os.Getenv("WEBHOOK_SECRET"),
+		))
+	case "mollie":
+		payment.Use(mollie.New(
+			os.Getenv("MOLLIE_API_URL"),
+			os.Getenv("MOLLIE_API_KEY"),
+			os.Getenv("WEBHOOK_SECRET"),
+		))
+	case "":
+		return fmt.Errorf("PAYMENT_PROVIDER environment variable is undeclared")
+	default:
+		// Only builds with the mollietest tag know the offline Mollie stand-in
+		if ok, err := initMockProvider(name); ok || err != nil {
+			return err
+		}
+		return fmt.Errorf("unknown payment provider %q", name)
+	}
+
+	return nil
+}
+
+// initJobs starts the background jobs.
+func initJobs() error {
+	// Parse how long orders may stay pending
+	orderTimeout := time.Hour
+	if value := os.Getenv("ORDER_TIMEOUT"); value != "" {
+		timeout, err := time.ParseDuration(value)
+		if err != nil || timeout <= 0 {
+			return fmt.Errorf("invalid ORDER_TIMEOUT %q", value)
+		}
+		orderTimeout = timeout
+	}
+
+	// Expire dormant balances only when a policy is configured
+	scheduled := []jobs.Job{jobs.ExpireOrders(orderTimeout)}
+	if policy := expiry.Get(); policy.Enabled() {
+		scheduled = append(scheduled, jobs.ExpireBalances(policy))
+	}
+
+	jobs.Start(scheduled...)
+	return nil
+}
+
+// initExpiry configures when balances of dormant cards expire.
+func initExpiry() error {
+	policy := expiry.Policy{Warning: 30 * 24 * time.Hour}
+
+	// Parse the number of months after the last purchase, balances never expire by default
+	if value := os.Getenv("BALANCE_EXPIRY_MONTHS"); value != "" {
+		months, err := strconv.Atoi(value)
+		if err != nil || months < 0 {
+			return fmt.Errorf("invalid BALANCE_EXPIRY_MONTHS %q", value)
+		}
+		policy.Months = months
+	}
+
+	// Parse how many days before expiry customers are warned
+	if value := os.Getenv("BALANCE_EXPIRY_WARNING_DAYS"); value != "" {
+		days, err := strconv.Atoi(value)
+		if err != nil || days < 0 {
+			return fmt.Errorf("invalid BALANCE_EXPIRY_WARNING_DAYS %q", value)
+		}
+		policy.Warning = time.Duration(days) * 24 * time.Hour
+	}
+
+	expiry.Use(policy)
+	return nil
+}
+
 // Initialize initializes the application
 func Initialize(relativeRootFolder string) error {
 	// Load configurations from .env file
@@ -55,31 +224,105 @@ func Initialize(relativeRootFolder string) error {
         return fmt.Errorf("failed to load .html templates: %v", err)
     }
 
+	// Load the pricing rules
+	if err := pricing.Load(fmt.Sprintf("%spricing.json", relativeRootFolder)); err != nil {
+		return fmt.Errorf("failed to load the pricing rules: %v", err)
+	}
+
+	// Configure the expiry of balances
+	if err := initExpiry(); err != nil {
+		return err
+	}
+
+	// Select the payment provider
+	if err := initPaymentProvider(); err != nil {
+		return fmt.Errorf("failed to initialize the payment provider: %v", err)
+	}
+
 	// Initialize the database connection
     if err := database.Connect(os.Getenv("MONGO_URI"), "backend"); err != nil {
         return fmt.Errorf("unable to establish connection to the database: %v", err)
     }
 
+	// Setup the products and migrate older data onto them
+	if err := initProducts(); err != nil {
+		return err
+	}
+
 	// Setup the admin card if needed
 	if err := initAdminCard(); err != nil {
 		return err
 	}
 
+	// Keep new server IDs clear of the ones already handed out
+	if err := cards.SyncServerIDs(context.TODO()); err != nil {
+		return fmt.Errorf("failed to synchronize the card server ID counter: %v", err)
+	}
+
+	// Give cards from before secret tokens existed their own token
+	if err := cards.AssignMissingTokens(context.TODO()); err != nil {
+		return fmt.Errorf("failed to assign tokens to the existing cards: %v", err)
+	}
+
+	// Let cards from before activity was tracked expire from their last purchase
+	if err := cards.MigrateLastActivity(context.TODO()); err != nil {
+		return fmt.Errorf("failed to migrate the last activity of the existing cards: %v", err)
+	}
+
+	// Bring the ledger up to date with the existing balances
+	if err := initLedger(); err != nil {
+		return err
+	}
+
+	// Start the background jobs
+	if err := initJobs(); err != nil {
+		return fmt.Errorf("failed to start the background jobs: %v", err)
+	}
+
     return nil
 }
 
+// InitializeCommand initializes only what command line subcommands need: the configuration,
+// the payment provider and the database connection. No jobs are started.
+func InitializeCommand(relativeRootFolder string) error {
+	// Load configurations from .env file
+	if err := godotenv.Load(fmt.Sprintf("%s.env", relativeRootFolder)); err != nil {
+		return fmt.Errorf("failed to load environment configurations from .env file: %v", err)
+	}
+
+	// Select the payment provider
+	if err := initPaymentProvider(); err != nil {
+		return fmt.Errorf("failed to initialize the payment provider: %v", err)
+	}
+
+	// Initialize the database connection
+	if err := database.Connect(os.Getenv("MONGO_URI"), "backend"); err != nil {
+		return fmt.Errorf("unable to establish connection to the database: %v", err)
+	}
+
+	return nil
+}
+
 // Clean is a function that performs cleanup operations, closing the server and disconnecting from the database.
 func Clean(server *http.Server) error {
     log.Println("Shutting down gracefully...")
     var errs []error
 
-    // Attempt to close the HTTP server
+    // Attempt to close the HTTP server, commands run without one
     ctx, cancel := context.WithTimeout(context.Background(), 10 * time.Second)
     defer cancel()
-    if err := server.Shutdown(ctx); err != nil {
-        errs = append(errs, fmt.Errorf("unable to shutdown the server: %v", err))
+    if server != nil {
+        if err := server.Shutdown(ctx); err != nil {
+            errs = append(errs, fmt.Errorf("unable to shutdown the server: %v", err))
+        }
     }
 
+    // Stop the background jobs before the database goes away
+    jobs.Stop()
+
+    // Stop the Mollie stand-in server when it was started
+    closeMockProvider()
+
     // Attempt to disconnect from the database
     if err := database.Disconnect(); err != nil {
         errs = append(errs, fmt.Errorf("unable to disconnect the database: %v", err))
@@ -0,0 +1,41 @@
+//go:build mollietest
+
+package app
+
+import (
+	"website/internal/payment"
+	"website/internal/payment/mollie"
+	"website/internal/payment/mollie/mollietest"
+
+	"fmt"
+	"log"
+	"os"
+)
+
+// mollieServer is the offline Mollie stand-in used by the "mollie-mock" provider
+var mollieServer *mollietest.Server
+
+// initMockProvider starts the offline Mollie stand-in when PAYMENT_PROVIDER is "mollie-mock",
+// reporting whether the name was recognised
+func initMockProvider(name string) (bool, error) {
+	if name != "mollie-mock" {
+		return false, nil
+	}
+	if os.Getenv("ENVIRONMENT") == "production" {
+		return true, fmt.Errorf("the mollie-mock provider cannot be used in production")
+	}
+
+	mollieServer = mollietest.NewServer("test_mock", os.Getenv("WEBHOOK_SECRET"))
+	payment.Use(mollie.New(mollieServer.APIURL(), "test_mock", os.Getenv("WEBHOOK_SECRET")))
+	log.Printf("Mollie stand-in server listening at %s\n", mollieServer.URL)
+
+	return true, nil
+}
+
+// closeMockProvider stops the Mollie stand-in server when it was started
+func closeMockProvider() {
+	if mollieServer != nil {
+		mollieServer.Close()
+		mollieServer = nil
+	}
+}
@@ -0,0 +1,12 @@
+//go:build !mollietest
+
+package app
+
+// initMockProvider recognises no providers, the offline Mollie stand-in is only built with
+// the mollietest tag
+func initMockProvider(name string) (bool, error) {
+	return false, nil
+}
+
+// closeMockProvider has nothing to stop without the mollietest tag
+func closeMockProvider() {}
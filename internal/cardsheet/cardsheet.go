@@ -0,0 +1,178 @@
+package cardsheet
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/skip2/go-qrcode"
+)
+
+// Page and card dimensions in PDF points (1/72 inch). Cards have the size of a bank card
+// and are laid out in a grid on A4 pages, with thin outlines to cut along.
+const (
+	mm = 72 / 25.4
+
+	pageWidth  = 210 * mm
+	pageHeight = 297 * mm
+
+	cardWidth  = 85.6 * mm
+	cardHeight = 54 * mm
+	columns    = 2
+	rows       = 5
+
+	padding = 4 * mm
+	qrSize  = cardHeight - 2*padding
+)
+
+// Card is a single card on the sheet
+type Card struct {
+	ServerID uint64 // Short number printed on the card
+	URL      string // Address the QR code points to
+}
+
+// WritePDF writes a printable PDF sheet of cards, each with its QR code, short ID and the bar name
+func WritePDF(w io.Writer, barName string, cards []Card) error {
+	// Draw every page
+	perPage := columns * rows
+	var pages []string
+	for start := 0; start < len(cards); start += perPage {
+		end := start + perPage
+		if end > len(cards) {
+			end = len(cards)
+		}
+		content, err := drawPage(barName, cards[start:end])
+		if err != nil {
+			return err
+		}
+		pages = append(pages, content)
+	}
+
+	// An empty sheet still needs a page to be a valid document
+	if len(pages) == 0 {
+		pages = append(pages, "")
+	}
+
+	_, err := w.Write(buildPDF(pages))
+	return err
+}
+
+// drawPage returns the PDF content stream of a page of cards
+func drawPage(barName string, cards []Card) (string, error) {
+	var content strings.Builder
+	marginX := (pageWidth - columns*cardWidth) / 2
+	marginY := (pageHeight - rows*cardHeight) / 2
+
+	for i, card := range cards {
+		// PDF coordinates start at the bottom left of the page
+		x := marginX + float64(i%columns)*cardWidth
+		y := pageHeight - marginY - float64(i/columns+1)*cardHeight
+
+		// Outline to cut along
+		fmt.Fprintf(&content, "0.8 G 0.5 w %.2f %.2f %.2f %.2f re S\n", x, y, cardWidth, cardHeight)
+
+		// QR code on the left
+		if err := drawQR(&content, card.URL, x+padding, y+padding, qrSize); err != nil {
+			return "", err
+		}
+
+		// Bar name and short ID on the right
+		textX := x + 2*padding + qrSize
+		fmt.Fprintf(&content, "0 g BT /F2 14 Tf %.2f %.2f Td (%s) Tj ET\n", textX, y+cardHeight-padding-14, escapeText(barName))
+		fmt.Fprintf(&content, "BT /F1 10 Tf %.2f %.2f Td (Card) Tj ET\n", textX, y+padding+32)
+		fmt.Fprintf(&content, "BT /F2 26 Tf %.2f %.2f Td (%d) Tj ET\n", textX, y+padding+4, card.ServerID)
+	}
+
+	return content.String(), nil
+}
+
+// drawQR draws the QR code of a text as filled squares into a square area
+func drawQR(content *strings.Builder, text string, x, y, size float64) error {
+	// Encode the text, without the border the card itself provides
+	code, err := qrcode.New(text, qrcode.Medium)
+	if err != nil {
+		return err
+	}
+	code.DisableBorder = true
+	bitmap := code.Bitmap()
+	module := size / float64(len(bitmap))
+
+	// Draw each horizontal run of dark modules as a single rectangle
+	content.WriteString("0 g\n")
+	for row, line := range bitmap {
+		top := y + size - float64(row+1)*module
+		for col := 0; col < len(line); col++ {
+			if !line[col] {
+				continue
+			}
+			start := col
+			for col+1 < len(line) && line[col+1] {
+				col++
+			}
+			fmt.Fprintf(content, "%.2f %.2f %.2f %.2f re\n", x+float64(start)*module, top, float64(col-start+1)*module, module)
+		}
+	}
+	content.WriteString("f\n")
+
+	return nil
+}
+
+// escapeText makes a text safe to use as a PDF string in the WinAnsi encoding of the standard fonts
+func escapeText(text string) string {
+	var escaped strings.Builder
+	for _, r := range text {
+		switch {
+		case r == '\\' || r == '(' || r == ')':
+			escaped.WriteRune('\\')
+			escaped.WriteRune(r)
+		case r < 32 || r > 255:
+			escaped.WriteByte('?')
+		default:
+			escaped.WriteByte(byte(r))
+		}
+	}
+	return escaped.String()
+}
+
+// buildPDF assembles a PDF document from the content streams of its pages
+func buildPDF(pages []string) []byte {
+	var doc bytes.Buffer
+	var offsets []int
+
+	// Objects are numbered from 1 in the order they are written
+	object := func(body string) {
+		offsets = append(offsets, doc.Len())
+		fmt.Fprintf(&doc, "%d 0 obj\n%s\nendobj\n", len(offsets), body)
+	}
+
+	// Pages are written after the catalog, the page tree and the fonts
+	const firstPage = 5
+	kids := make([]string, len(pages))
+	for i := range pages {
+		kids[i] = fmt.Sprintf("%d 0 R", firstPage+2*i)
+	}
+
+	doc.WriteString("%PDF-1.4\n")
+	object("<< /Type /Catalog /Pages 2 0 R >>")
+	object(fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(pages)))
+	object("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica /Encoding /WinAnsiEncoding >>")
+	object("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica-Bold /Encoding /WinAnsiEncoding >>")
+	for i, content := range pages {
+		object(fmt.Sprintf(
+			"<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %.2f %.2f] /Resources << /Font << /F1 3 0 R /F2 4 0 R >> >> /Contents %d 0 R >>",
+			pageWidth, pageHeight, firstPage+2*i+1,
+		))
+		object(fmt.Sprintf("<< /Length %d >>\nstream\n%s\nendstream", len(content), content))
+	}
+
+	// Cross-reference table pointing at every object
+	xref := doc.Len()
+	fmt.Fprintf(&doc, "xref\n0 %d\n0000000000 65535 f \n", len(offsets)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&doc, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&doc, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(offsets)+1, xref)
+
+	return doc.Bytes()
+}
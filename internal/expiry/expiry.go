@@ -0,0 +1,74 @@
+package expiry
+
+import (
+	"sync"
+	"time"
+)
+
+// Policy decides when the balance of a card expires. Balances expire a number of months after
+// drinks were last added to the card, or after it was created when that never happened.
+type Policy struct {
+	Months  int           // Months after the last activity, zero disables expiry
+	Warning time.Duration // How long before expiry the customer is warned
+}
+
+var (
+	mu      sync.Mutex
+	current Policy
+)
+
+// Use sets the policy used by the application
+func Use(policy Policy) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	current = policy
+}
+
+// Get returns the policy used by the application
+func Get() Policy {
+	mu.Lock()
+	defer mu.Unlock()
+
+	return current
+}
+
+// Enabled reports whether balances expire at all
+func (p Policy) Enabled() bool {
+	return p.Months > 0
+}
+
+// ExpiresAt returns when the balance of a card with the given last activity expires.
+// False is returned when it never expires.
+func (p Policy) ExpiresAt(lastActivity time.Time) (time.Time, bool) {
+	if !p.Enabled() {
+		return time.Time{}, false
+	}
+	return addMonths(lastActivity, p.Months), true
+}
+
+// Warn reports whether the customer should be warned about the upcoming expiry of a balance
+func (p Policy) Warn(lastActivity, now time.Time) bool {
+	expiresAt, ok := p.ExpiresAt(lastActivity)
+	return ok && !now.Before(expiresAt.Add(-p.Warning))
+}
+
+// Cutoff returns the moment before which a last activity makes a balance expired at now. It
+// moves back by the same months ExpiresAt moves forward, so both agree on what has expired.
+func (p Policy) Cutoff(now time.Time) time.Time {
+	return addMonths(now, -p.Months)
+}
+
+// addMonths moves a moment a number of months forward or back. A day that does not exist in the
+// month it lands in, such as the 31st one month after January, becomes the start of the next
+// month instead, so a later moment never lands before an earlier one.
+func addMonths(t time.Time, months int) time.Time {
+	year, month, day := t.Date()
+	first := time.Date(year, month+time.Month(months), 1, 0, 0, 0, 0, t.Location())
+	if day > first.AddDate(0, 1, -1).Day() {
+		return first.AddDate(0, 1, 0)
+	}
+
+	hour, minute, second := t.Clock()
+	return time.Date(year, month+time.Month(months), day, hour, minute, second, t.Nanosecond(), t.Location())
+}
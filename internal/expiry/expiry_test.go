@@ -0,0 +1,84 @@
+package expiry
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPolicy(t *testing.T) {
+	lastActivity := time.Date(2024, time.January, 31, 12, 0, 0, 0, time.UTC)
+	policy := Policy{Months: 12, Warning: 30 * 24 * time.Hour}
+	expiresAt := lastActivity.AddDate(1, 0, 0)
+
+	tests := []struct {
+		name         string
+		policy       Policy
+		lastActivity time.Time
+		now          time.Time
+		expires      bool
+		warn         bool
+	}{
+		{"disabled", Policy{}, lastActivity, expiresAt.Add(time.Hour), false, false},
+		{"long before expiry", policy, lastActivity, lastActivity.AddDate(0, 6, 0), true, false},
+		{"just before warning", policy, lastActivity, expiresAt.Add(-policy.Warning - time.Second), true, false},
+		{"warning starts", policy, lastActivity, expiresAt.Add(-policy.Warning), true, true},
+		{"expired", policy, lastActivity, expiresAt.Add(time.Hour), true, true},
+		{"no warning period", Policy{Months: 12}, lastActivity, expiresAt.Add(-time.Second), true, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, ok := test.policy.ExpiresAt(test.lastActivity)
+			if ok != test.expires {
+				t.Fatalf("ExpiresAt ok = %v, want %v", ok, test.expires)
+			}
+			if ok && !got.Equal(expiresAt) {
+				t.Errorf("ExpiresAt = %v, want %v", got, expiresAt)
+			}
+			if warn := test.policy.Warn(test.lastActivity, test.now); warn != test.warn {
+				t.Errorf("Warn = %v, want %v", warn, test.warn)
+			}
+		})
+	}
+}
+
+func TestAddMonths(t *testing.T) {
+	tests := []struct {
+		name   string
+		from   time.Time
+		months int
+		want   time.Time
+	}{
+		{"same day", time.Date(2024, time.March, 15, 8, 30, 0, 0, time.UTC), 1, time.Date(2024, time.April, 15, 8, 30, 0, 0, time.UTC)},
+		{"into the next year", time.Date(2024, time.November, 28, 0, 0, 0, 0, time.UTC), 3, time.Date(2025, time.February, 28, 0, 0, 0, 0, time.UTC)},
+		{"past the end of february", time.Date(2025, time.January, 31, 12, 0, 0, 0, time.UTC), 1, time.Date(2025, time.March, 1, 0, 0, 0, 0, time.UTC)},
+		{"leap day", time.Date(2024, time.January, 29, 12, 0, 0, 0, time.UTC), 1, time.Date(2024, time.February, 29, 12, 0, 0, 0, time.UTC)},
+		{"back past the end of february", time.Date(2025, time.March, 31, 12, 0, 0, 0, time.UTC), -1, time.Date(2025, time.March, 1, 0, 0, 0, 0, time.UTC)},
+		{"back into the previous year", time.Date(2025, time.March, 15, 8, 0, 0, 0, time.UTC), -6, time.Date(2024, time.September, 15, 8, 0, 0, 0, time.UTC)},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := addMonths(test.from, test.months); !got.Equal(test.want) {
+				t.Errorf("addMonths(%v, %d) = %v, want %v", test.from, test.months, got, test.want)
+			}
+		})
+	}
+}
+
+// TestCutoff checks that the cutoff used by the expiry job agrees with the date customers are
+// warned about, including at the end of months of different lengths
+func TestCutoff(t *testing.T) {
+	policy := Policy{Months: 1}
+	start := time.Date(2024, time.December, 25, 6, 0, 0, 0, time.UTC)
+
+	for now := start; now.Before(start.AddDate(0, 4, 0)); now = now.Add(13 * time.Hour) {
+		cutoff := policy.Cutoff(now)
+		for _, lastActivity := range []time.Time{cutoff.Add(-time.Second), cutoff, cutoff.Add(time.Second), now.AddDate(0, -1, -2), now.AddDate(0, -1, 2)} {
+			expiresAt, _ := policy.ExpiresAt(lastActivity)
+			if expired, want := lastActivity.Before(cutoff), expiresAt.Before(now); expired != want {
+				t.Errorf("at %v a last activity of %v expired = %v, but it expires at %v", now, lastActivity, expired, expiresAt)
+			}
+		}
+	}
+}
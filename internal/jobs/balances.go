@@ -0,0 +1,45 @@
+package jobs
+
+import (
+	"website/internal/expiry"
+	"website/internal/settlement"
+	"website/utils/database/models/cards"
+
+	"context"
+	"fmt"
+	"log"
+	"time"
+)
+
+// expireBalances takes the drinks from cards that were not active for longer than the policy allows
+func expireBalances(ctx context.Context, policy expiry.Policy) error {
+	// Get the cards that have been dormant for too long
+	cutoff := policy.Cutoff(time.Now())
+	dormant, err := cards.GetDormant(ctx, cutoff)
+	if err != nil {
+		return err
+	}
+
+	note := fmt.Sprintf("expired %d months after drinks were last added", policy.Months)
+	for _, card := range dormant {
+		expired, err := settlement.Expire(ctx, card.ID, cutoff, note)
+		if err != nil {
+			log.Printf("[Warning] failed to expire the balance of card %d: %v", card.ServerID, err)
+		} else if expired > 0 {
+			log.Printf("Expired %d beers on card %d", expired, card.ServerID)
+		}
+	}
+
+	return nil
+}
+
+// ExpireBalances creates a job that expires the balances of dormant cards according to the policy
+func ExpireBalances(policy expiry.Policy) Job {
+	return Job{
+		Name:     "expire balances",
+		Interval: time.Hour,
+		Run: func(ctx context.Context) error {
+			return expireBalances(ctx, policy)
+		},
+	}
+}
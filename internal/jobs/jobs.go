@@ -0,0 +1,75 @@
+package jobs
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+)
+
+// Job is a task that runs periodically in the background
+type Job struct {
+	Name     string
+	Interval time.Duration
+	Run      func(ctx context.Context) error
+}
+
+var (
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+	mu     sync.Mutex
+)
+
+// run executes a job every interval until the context is cancelled
+func run(ctx context.Context, job Job) {
+	defer wg.Done()
+
+	ticker := time.NewTicker(job.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := job.Run(ctx); err != nil && ctx.Err() == nil {
+				log.Printf("[Warning] job %s failed: %v", job.Name, err)
+			}
+		}
+	}
+}
+
+// Start runs the given jobs in the background until Stop is called
+func Start(jobs ...Job) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	// Jobs can only be started once
+	if cancel != nil {
+		return
+	}
+
+	// Create a context shared by all jobs
+	var ctx context.Context
+	ctx, cancel = context.WithCancel(context.Background())
+
+	// Start a goroutine for every job
+	for _, job := range jobs {
+		wg.Add(1)
+		go run(ctx, job)
+	}
+}
+
+// Stop cancels all running jobs and waits for them to return
+func Stop() {
+	mu.Lock()
+	defer mu.Unlock()
+
+	if cancel == nil {
+		return
+	}
+
+	cancel()
+	wg.Wait()
+	cancel = nil
+}
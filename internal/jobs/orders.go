@@ -0,0 +1,61 @@
+package jobs
+
+import (
+	"website/internal/payment"
+	"website/internal/settlement"
+	"website/utils/database/models/orders"
+
+	"context"
+	"errors"
+	"log"
+	"time"
+)
+
+// expireOrders settles pending orders older than timeout. When the payment provider can report
+// the status of a payment, that status is used instead, and payments it still considers open are left alone.
+func expireOrders(ctx context.Context, timeout time.Duration) error {
+	// Get the orders that have been pending for too long
+	pending, err := orders.GetPendingBefore(ctx, time.Now().Add(-timeout))
+	if err != nil {
+		return err
+	}
+
+	for _, order := range pending {
+		status := orders.StatusExpired
+
+		// Ask the payment provider what happened to the payment
+		if order.PaymentID != "" {
+			current, err := payment.Get().GetStatus(ctx, order.PaymentID)
+			if err == nil {
+				status = current.Status
+			} else if !errors.Is(err, payment.ErrNotSupported) {
+				log.Printf("[Warning] failed to get the payment status of order %s: %v", order.ID.Hex(), err)
+				continue
+			}
+		}
+
+		// The customer may still complete an open payment
+		if status == orders.StatusPending {
+			continue
+		}
+
+		// Settle the order, a webhook may have beaten us to it
+		err := settlement.Settle(ctx, order.ID, status)
+		if err != nil && !errors.Is(err, orders.ErrAlreadyProcessed) {
+			log.Printf("[Warning] failed to settle order %s as %s: %v", order.ID.Hex(), status, err)
+		}
+	}
+
+	return nil
+}
+
+// ExpireOrders creates a job that expires orders which stayed pending for longer than timeout
+func ExpireOrders(timeout time.Duration) Job {
+	return Job{
+		Name:     "expire orders",
+		Interval: time.Minute,
+		Run: func(ctx context.Context) error {
+			return expireOrders(ctx, timeout)
+		},
+	}
+}
@@ -0,0 +1,30 @@
+package middleware
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+	"os"
+)
+
+// TapAuthenticationMiddleware only lets through requests carrying the shared tap key
+func TapAuthenticationMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Refuse every request when no tap key was configured
+		key := os.Getenv("TAP_KEY")
+		if key == "" {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		// Compare the Authorization header in constant time
+		expected := fmt.Sprintf("Bearer %s", key)
+		if subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), []byte(expected)) != 1 {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		// Pass on the Request
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,98 @@
+package pairing
+
+import (
+	"sync"
+	"time"
+)
+
+// DefaultTimeout is how long the tap waits for a tag to be scanned after pairing is started
+const DefaultTimeout = 2 * time.Minute
+
+// Session is a request to bind the next tag scanned at the tap to a card
+type Session struct {
+	ServerID  uint64    `json:"server_id"`
+	StartedAt time.Time `json:"started_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// Result describes how the last pairing session ended
+type Result struct {
+	ServerID uint64    `json:"server_id"`
+	UID      string    `json:"uid,omitempty"`
+	Error    string    `json:"error,omitempty"`
+	At       time.Time `json:"at"`
+}
+
+var (
+	mu      sync.Mutex
+	current *Session
+	last    *Result
+)
+
+// Start begins pairing the next scanned tag with a card, replacing any session in progress
+func Start(serverID uint64, timeout time.Duration) Session {
+	mu.Lock()
+	defer mu.Unlock()
+
+	now := time.Now()
+	current = &Session{ServerID: serverID, StartedAt: now, ExpiresAt: now.Add(timeout)}
+	return *current
+}
+
+// Current returns the session in progress, or nil when the tap is not pairing
+func Current() *Session {
+	mu.Lock()
+	defer mu.Unlock()
+
+	return active(time.Now())
+}
+
+// Take ends the session in progress and returns it, so only a single scan is paired with it.
+// Nil is returned when the tap is not pairing.
+func Take() *Session {
+	mu.Lock()
+	defer mu.Unlock()
+
+	session := active(time.Now())
+	current = nil
+	return session
+}
+
+// Cancel ends the session in progress without pairing a tag
+func Cancel() {
+	mu.Lock()
+	defer mu.Unlock()
+
+	current = nil
+}
+
+// Finish records how a taken session ended, so the owner can see the outcome
+func Finish(result Result) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	result.At = time.Now()
+	last = &result
+}
+
+// Last returns how the last session ended, or nil when none ended yet
+func Last() *Result {
+	mu.Lock()
+	defer mu.Unlock()
+
+	if last == nil {
+		return nil
+	}
+	result := *last
+	return &result
+}
+
+// active returns a copy of the current session if it has not expired. The caller holds the lock.
+func active(now time.Time) *Session {
+	if current == nil || now.After(current.ExpiresAt) {
+		current = nil
+		return nil
+	}
+	session := *current
+	return &session
+}
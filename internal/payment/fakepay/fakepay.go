@@ -1,66 +1,144 @@
 package fakepay
 
 import (
+	"website/internal/payment"
+	"website/utils/database/models/orders"
+	"website/utils/money"
+
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"net/http"
-	"os"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
 )
 
 // Create a struct with the same structure as TransactionInput in the fakepay api
 type FakepayTransactionInput struct {
     Amount      float64 `json:"amount"`
     WebhookURL  string  `json:"webhook_url"`
-    WebhookKey  string  `json:"webhook_key"`
     RedirectURL string  `json:"redirect_url"`
 }
 
-// FakepayProcessor prepares and executes a transaction,
+// Provider takes payments through the fakepay development gateway
+type Provider struct {
+	gateURL       string
+	gateKey       string
+	webhookSecret []byte
+}
+
+// New creates a fakepay provider for the gateway at gateURL. Webhooks must be signed
+// with webhookSecret, which is shared with the gateway out of band.
+func New(gateURL, gateKey, webhookSecret string) *Provider {
+	return &Provider{
+		gateURL:       gateURL,
+		gateKey:       gateKey,
+		webhookSecret: []byte(webhookSecret),
+	}
+}
+
+// CreatePayment prepares and executes a transaction,
 // then modifies the URL and returns it as the redirection URL.
-func FakepayProcessor(input FakepayTransactionInput) (string, error) {
+func (p *Provider) CreatePayment(ctx context.Context, input payment.Input) (*payment.Payment, error) {
+	// Fakepay only knows euros, written as a decimal number
+	if input.Amount.Currency != "EUR" {
+		return nil, fmt.Errorf("fakepay does not support currency %s", input.Amount.Currency)
+	}
+	amount, err := strconv.ParseFloat(input.Amount.String(), 64)
+	if err != nil {
+		return nil, err
+	}
+
 	// Convert transaction input to JSON
-	transactionData, err := json.Marshal(input)
+	transactionData, err := json.Marshal(FakepayTransactionInput{
+		Amount:      amount,
+		WebhookURL:  input.WebhookURL,
+		RedirectURL: input.RedirectURL,
+	})
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 
 	// Create a new POST request to CreateTransaction endpoint on the transaction server
-	transactionURL := os.Getenv("PAYMENT_GATE_URL")
-	req, err := http.NewRequest("POST", transactionURL, bytes.NewBuffer(transactionData))
+	req, err := http.NewRequestWithContext(ctx, "POST", p.gateURL, bytes.NewBuffer(transactionData))
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 
 	// Set the Content-Type header for the request
 	req.Header.Set("Content-Type", "application/json")
 
 	// Set the Authorization header for the request
-	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", os.Getenv("PAYMENT_GATE_KEY")))
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", p.gateKey))
 
 	// Make the POST request with the prepared request object
 	response, err := http.DefaultClient.Do(req)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 	defer response.Body.Close()
 
 	// Check the response status code
 	if response.StatusCode != http.StatusCreated {
-		return "", fmt.Errorf("Failed to create transaction: %d", response.StatusCode)
+		return nil, fmt.Errorf("Failed to create transaction: %d", response.StatusCode)
 	}
 
 	// Read the response body to get the URL
 	var responseMap map[string]string
 	if err := json.NewDecoder(response.Body).Decode(&responseMap); err != nil {
-		return "", err
+		return nil, err
 	}
 
 	// Get the redirection URL
 	transactionURL, exists := responseMap["url"]
 	if !exists {
-		return "", fmt.Errorf("Invalid transaction response")
+		return nil, fmt.Errorf("Invalid transaction response")
 	}
 
-	return transactionURL, nil
+	// Modify the URL to replace "localhost" with the host the customer is using
+	if redirect, err := url.Parse(input.RedirectURL); err == nil && redirect.Hostname() != "" {
+		transactionURL = strings.Replace(transactionURL, "localhost", redirect.Hostname(), -1)
+	}
+
+	// Fakepay does not hand out payment IDs, payments are identified by their webhook URL
+	return &payment.Payment{
+		ID:          input.Reference,
+		CheckoutURL: transactionURL,
+		Status:      orders.StatusPending,
+		Amount:      input.Amount,
+	}, nil
+}
+
+// ParseWebhook checks the webhook signature and reads the status posted by fakepay
+func (p *Provider) ParseWebhook(r *http.Request) (*payment.WebhookEvent, error) {
+	// Check the signature over the timestamp, method, path and body
+	if err := payment.VerifyRequest(r, p.webhookSecret, payment.DefaultReplayWindow, time.Now()); err != nil {
+		return nil, err
+	}
+
+	// Parse the form data
+	if err := r.ParseForm(); err != nil {
+		return nil, err
+	}
+
+	// Access form fields by name
+	status, err := orders.ParseStatus(r.FormValue("Status"))
+	if err != nil {
+		return nil, err
+	}
+
+	return &payment.WebhookEvent{Status: status}, nil
+}
+
+// Refund is not offered by fakepay
+func (p *Provider) Refund(ctx context.Context, paymentID string, amount money.Money, idempotencyKey string) error {
+	return payment.ErrNotSupported
+}
+
+// GetStatus is not offered by fakepay
+func (p *Provider) GetStatus(ctx context.Context, paymentID string) (*payment.Payment, error) {
+	return nil, payment.ErrNotSupported
 }
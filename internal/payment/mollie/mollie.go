@@ -0,0 +1,254 @@
+package mollie
+
+import (
+	"website/internal/payment"
+	"website/utils/database/models/orders"
+	"website/utils/money"
+
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// DefaultAPIURL is the base URL of the live Mollie API
+const DefaultAPIURL = "https://api.mollie.com/v2"
+
+// amount represents a monetary value the way the Mollie API writes it
+type amount struct {
+	Currency string `json:"currency"`
+	Value    string `json:"value"`
+}
+
+// link represents a single entry of the _links object in Mollie responses
+type link struct {
+	Href string `json:"href"`
+}
+
+// paymentRequest represents the body of a create payment request
+type paymentRequest struct {
+	Amount      amount            `json:"amount"`
+	Description string            `json:"description"`
+	RedirectURL string            `json:"redirectUrl"`
+	WebhookURL  string            `json:"webhookUrl"`
+	Metadata    map[string]string `json:"metadata,omitempty"`
+}
+
+// paymentResponse represents a payment object returned by the Mollie API
+type paymentResponse struct {
+	ID     string `json:"id"`
+	Status string `json:"status"`
+	Amount amount `json:"amount"`
+	Links  struct {
+		Checkout *link `json:"checkout"`
+	} `json:"_links"`
+}
+
+// refundRequest represents the body of a create refund request
+type refundRequest struct {
+	Amount amount `json:"amount"`
+}
+
+// errorResponse represents an error returned by the Mollie API
+type errorResponse struct {
+	Status int    `json:"status"`
+	Title  string `json:"title"`
+	Detail string `json:"detail"`
+}
+
+// Provider takes payments through the Mollie API or any server speaking the same protocol
+type Provider struct {
+	apiURL        string
+	apiKey        string
+	webhookSecret []byte
+	client        *http.Client
+}
+
+// New creates a Mollie provider talking to the API at apiURL. When webhookSecret is set,
+// webhooks must additionally be signed with it, for gateways that sign their webhooks.
+func New(apiURL, apiKey, webhookSecret string) *Provider {
+	if apiURL == "" {
+		apiURL = DefaultAPIURL
+	}
+
+	return &Provider{
+		apiURL:        apiURL,
+		apiKey:        apiKey,
+		webhookSecret: []byte(webhookSecret),
+		client:        &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// toAmount converts money into a Mollie amount
+func toAmount(value money.Money) amount {
+	return amount{Currency: value.Currency, Value: value.String()}
+}
+
+// fromAmount converts a Mollie amount into money
+func fromAmount(a amount) (money.Money, error) {
+	return money.Parse(a.Value, a.Currency)
+}
+
+// toStatus maps a Mollie payment status onto an order status
+func toStatus(status string) (orders.Status, error) {
+	switch status {
+	case "open", "pending", "authorized":
+		return orders.StatusPending, nil
+	case "paid":
+		return orders.StatusPaid, nil
+	case "failed":
+		return orders.StatusFailed, nil
+	case "canceled":
+		return orders.StatusCancelled, nil
+	case "expired":
+		return orders.StatusExpired, nil
+	default:
+		return "", fmt.Errorf("unknown Mollie payment status %q", status)
+	}
+}
+
+// do sends a request to the Mollie API and decodes the response into out. The idempotency key,
+// when set, lets Mollie recognize a repeated request and answer it without acting twice.
+func (p *Provider) do(ctx context.Context, method, path, idempotencyKey string, body, out interface{}) error {
+	// Convert the request body to JSON
+	var reader *bytes.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(data)
+	} else {
+		reader = bytes.NewReader(nil)
+	}
+
+	// Create the request
+	req, err := http.NewRequestWithContext(ctx, method, p.apiURL+path, reader)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", p.apiKey))
+	if idempotencyKey != "" {
+		req.Header.Set("Idempotency-Key", idempotencyKey)
+	}
+
+	// Send the request
+	response, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	// Turn API errors into Go errors, client errors mean Mollie refused the request
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		var apiErr errorResponse
+		err := fmt.Errorf("Mollie API returned status %d", response.StatusCode)
+		if json.NewDecoder(response.Body).Decode(&apiErr) == nil && apiErr.Detail != "" {
+			err = fmt.Errorf("Mollie API returned status %d: %s", response.StatusCode, apiErr.Detail)
+		}
+		if response.StatusCode >= 400 && response.StatusCode <= 499 {
+			return fmt.Errorf("%w: %v", payment.ErrDeclined, err)
+		}
+		return err
+	}
+
+	// Decode the response
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(response.Body).Decode(out)
+}
+
+// toPayment converts a Mollie payment object into a payment
+func toPayment(response paymentResponse) (*payment.Payment, error) {
+	status, err := toStatus(response.Status)
+	if err != nil {
+		return nil, err
+	}
+
+	value, err := fromAmount(response.Amount)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &payment.Payment{
+		ID:     response.ID,
+		Status: status,
+		Amount: value,
+	}
+	if response.Links.Checkout != nil {
+		result.CheckoutURL = response.Links.Checkout.Href
+	}
+
+	return result, nil
+}
+
+// CreatePayment creates a payment at Mollie and returns its checkout URL
+func (p *Provider) CreatePayment(ctx context.Context, input payment.Input) (*payment.Payment, error) {
+	request := paymentRequest{
+		Amount:      toAmount(input.Amount),
+		Description: input.Description,
+		RedirectURL: input.RedirectURL,
+		WebhookURL:  input.WebhookURL,
+		Metadata:    map[string]string{"reference": input.Reference},
+	}
+
+	var response paymentResponse
+	if err := p.do(ctx, http.MethodPost, "/payments", "", request, &response); err != nil {
+		return nil, err
+	}
+
+	return toPayment(response)
+}
+
+// ParseWebhook reads the payment ID posted by Mollie and fetches its status from the API,
+// so the contents of the webhook request itself never have to be trusted
+func (p *Provider) ParseWebhook(r *http.Request) (*payment.WebhookEvent, error) {
+	// Check the signature when the gateway signs its webhooks
+	if len(p.webhookSecret) > 0 {
+		if err := payment.VerifyRequest(r, p.webhookSecret, payment.DefaultReplayWindow, time.Now()); err != nil {
+			return nil, err
+		}
+	}
+
+	// Parse the form data
+	if err := r.ParseForm(); err != nil {
+		return nil, err
+	}
+
+	// Mollie only posts the ID of the payment that changed
+	id := r.FormValue("id")
+	if id == "" {
+		return nil, errors.New("webhook request is missing the payment id")
+	}
+
+	// Ask Mollie for the actual status
+	current, err := p.GetStatus(r.Context(), id)
+	if err != nil {
+		return nil, err
+	}
+
+	return &payment.WebhookEvent{PaymentID: current.ID, Status: current.Status}, nil
+}
+
+// Refund refunds an amount of a paid payment, once per idempotency key
+func (p *Provider) Refund(ctx context.Context, paymentID string, value money.Money, idempotencyKey string) error {
+	path := fmt.Sprintf("/payments/%s/refunds", url.PathEscape(paymentID))
+	return p.do(ctx, http.MethodPost, path, idempotencyKey, refundRequest{Amount: toAmount(value)}, nil)
+}
+
+// GetStatus fetches a payment from Mollie
+func (p *Provider) GetStatus(ctx context.Context, paymentID string) (*payment.Payment, error) {
+	var response paymentResponse
+	path := fmt.Sprintf("/payments/%s", url.PathEscape(paymentID))
+	if err := p.do(ctx, http.MethodGet, path, "", nil, &response); err != nil {
+		return nil, err
+	}
+
+	return toPayment(response)
+}
@@ -0,0 +1,301 @@
+package mollie_test
+
+import (
+	"website/internal/payment"
+	"website/internal/payment/mollie"
+	"website/internal/payment/mollie/mollietest"
+	"website/internal/settlement"
+	"website/utils/database"
+	"website/utils/database/models/cards"
+	"website/utils/database/models/orders"
+	"website/utils/database/models/products"
+	"website/utils/money"
+
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	testAPIKey = "test_key"
+	testSecret = "test_secret"
+)
+
+// shop stands in for the website, receiving the webhooks of the stand-in Mollie server
+type shop struct {
+	*httptest.Server
+	events chan *payment.WebhookEvent
+}
+
+// newShop starts a server that authenticates webhooks with the provider. When settle is
+// set, the order named in the webhook URL is settled like the website would.
+func newShop(t *testing.T, provider *mollie.Provider, settle bool) *shop {
+	t.Helper()
+
+	s := &shop{events: make(chan *payment.WebhookEvent, 10)}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		event, err := provider.ParseWebhook(r)
+		if errors.Is(err, payment.ErrUnauthorized) {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		} else if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		// Settle the order, a repeated webhook is not an error
+		if settle {
+			orderID, err := primitive.ObjectIDFromHex(r.URL.Query().Get("order"))
+			if err != nil {
+				http.Error(w, "Invalid ID", http.StatusBadRequest)
+				return
+			}
+			err = settlement.Settle(r.Context(), orderID, event.Status)
+			if err != nil && !errors.Is(err, orders.ErrAlreadyProcessed) {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+		}
+
+		s.events <- event
+	}))
+	t.Cleanup(s.Close)
+
+	return s
+}
+
+// nextEvent waits for the shop to receive a webhook
+func (s *shop) nextEvent(t *testing.T) *payment.WebhookEvent {
+	t.Helper()
+
+	select {
+	case event := <-s.events:
+		return event
+	case <-time.After(5 * time.Second):
+		t.Fatal("no webhook was received")
+		return nil
+	}
+}
+
+// checkout completes a payment on the checkout page of the stand-in server
+func checkout(t *testing.T, created *payment.Payment, status string) {
+	t.Helper()
+
+	// Show the checkout page
+	response, err := http.Get(created.CheckoutURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	page, _ := io.ReadAll(response.Body)
+	response.Body.Close()
+	if response.StatusCode != http.StatusOK || !strings.Contains(string(page), created.ID) {
+		t.Fatalf("checkout page returned status %d: %s", response.StatusCode, page)
+	}
+
+	// Pick the outcome, which sends the customer back to the redirect URL
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}}
+	response, err = client.PostForm(created.CheckoutURL, url.Values{"status": {status}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	response.Body.Close()
+	if response.StatusCode != http.StatusSeeOther {
+		t.Fatalf("completing the checkout returned status %d", response.StatusCode)
+	}
+}
+
+func TestPaymentFlow(t *testing.T) {
+	ctx := context.Background()
+	server := mollietest.NewServer(testAPIKey, testSecret)
+	defer server.Close()
+	provider := mollie.New(server.APIURL(), testAPIKey, testSecret)
+	shop := newShop(t, provider, false)
+
+	// Create the payment
+	created, err := provider.CreatePayment(ctx, payment.Input{
+		Reference:   "order",
+		Description: "2 beers",
+		Amount:      money.New(500, "EUR"),
+		WebhookURL:  shop.URL + "/webhook",
+		RedirectURL: shop.URL + "/done",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if created.Status != orders.StatusPending || created.CheckoutURL == "" || !created.Amount.Equal(money.New(500, "EUR")) {
+		t.Fatalf("created payment = %+v", created)
+	}
+
+	// Pay at the checkout, which calls the webhook
+	checkout(t, created, "paid")
+	event := shop.nextEvent(t)
+	if event.PaymentID != created.ID || event.Status != orders.StatusPaid {
+		t.Fatalf("webhook event = %+v, want %s paid", event, created.ID)
+	}
+
+	// The status is available from the API as well
+	current, err := provider.GetStatus(ctx, created.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if current.Status != orders.StatusPaid || current.CheckoutURL != "" {
+		t.Fatalf("current payment = %+v", current)
+	}
+
+	// Partial refunds add up, a repeated key refunds only once
+	refunds := []struct {
+		value int64
+		key   string
+	}{{200, "refund-1"}, {200, "refund-1"}, {300, "refund-2"}}
+	for _, refund := range refunds {
+		if err := provider.Refund(ctx, created.ID, money.New(refund.value, "EUR"), refund.key); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if p, _ := server.Payment(created.ID); p.AmountRefunded != "5.00" {
+		t.Errorf("amount refunded = %q, want 5.00", p.AmountRefunded)
+	}
+
+	// Refunding more than was paid is declined
+	err = provider.Refund(ctx, created.ID, money.New(1, "EUR"), "refund-3")
+	if !errors.Is(err, payment.ErrDeclined) {
+		t.Errorf("refunding more than was paid returned %v, want %v", err, payment.ErrDeclined)
+	}
+}
+
+func TestWebhookSignature(t *testing.T) {
+	ctx := context.Background()
+	server := mollietest.NewServer(testAPIKey, "other_secret")
+	defer server.Close()
+	provider := mollie.New(server.APIURL(), testAPIKey, testSecret)
+	shop := newShop(t, provider, false)
+
+	created, err := provider.CreatePayment(ctx, payment.Input{
+		Amount:     money.New(250, "EUR"),
+		WebhookURL: shop.URL + "/webhook",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A webhook signed with another secret is refused
+	if err := server.SetStatus(created.ID, "paid"); err == nil || !strings.Contains(err.Error(), "401") {
+		t.Fatalf("webhook signed with another secret returned %v, want status 401", err)
+	}
+}
+
+// TestSettle runs a payment through to a credited card and refunds it in parts. It needs a
+// MongoDB replica set, given by MONGO_TEST_URI, because settling uses transactions.
+func TestSettle(t *testing.T) {
+	uri := os.Getenv("MONGO_TEST_URI")
+	if uri == "" {
+		t.Skip("MONGO_TEST_URI is not set")
+	}
+	ctx := context.Background()
+
+	// Connect to a database of its own, dropped afterwards
+	name := fmt.Sprintf("mollietest_%d", time.Now().UnixNano())
+	if err := database.Connect(uri, name); err != nil {
+		t.Fatal(err)
+	}
+	defer database.Disconnect()
+	defer database.GetCollection("orders").Database().Drop(ctx)
+
+	server := mollietest.NewServer(testAPIKey, testSecret)
+	defer server.Close()
+	provider := mollie.New(server.APIURL(), testAPIKey, testSecret)
+	shop := newShop(t, provider, true)
+
+	// Create a card with an order for two beers
+	product := products.New("Beer", money.New(250, "EUR"), "")
+	if _, err := products.Insert(ctx, &product); err != nil {
+		t.Fatal(err)
+	}
+	card, err := cards.NewWithServerID(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	card.ID = primitive.NewObjectID()
+	if err := cards.Insert(ctx, &card); err != nil {
+		t.Fatal(err)
+	}
+	order := orders.New(card.ID, product.ID, 2, product.Price, product.Price.Times(2), "")
+	if _, err := orders.Insert(ctx, &order); err != nil {
+		t.Fatal(err)
+	}
+
+	// Pay for the order
+	created, err := provider.CreatePayment(ctx, payment.Input{
+		Reference:  order.ID.Hex(),
+		Amount:     order.TotalAmount,
+		WebhookURL: shop.URL + "/webhook?order=" + order.ID.Hex(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := orders.SetPaymentID(ctx, order.ID, created.ID); err != nil {
+		t.Fatal(err)
+	}
+	checkout(t, created, "paid")
+	shop.nextEvent(t)
+
+	// A repeated webhook must not credit the card again
+	if err := server.SetStatus(created.ID, "paid"); err != nil {
+		t.Fatal(err)
+	}
+	shop.nextEvent(t)
+
+	// Check the order and the card
+	settled, err := orders.GetByID(ctx, order.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if settled.Status != orders.StatusPaid {
+		t.Errorf("order status = %s, want %s", settled.Status, orders.StatusPaid)
+	}
+	credited, err := cards.GetByID(ctx, card.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if beers := credited.Balance(product.ID); beers != 2 {
+		t.Errorf("card balance = %d, want 2", beers)
+	}
+
+	// Refund the order one beer at a time, it is only Refunded after the last one
+	payment.Use(provider)
+	defer payment.Use(nil)
+	for i, want := range []orders.Status{orders.StatusPaid, orders.StatusRefunded} {
+		result, err := settlement.Refund(ctx, order.ID, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if result.Beers != 1 || result.Debited != 1 || result.Remaining != uint(1-i) {
+			t.Errorf("refund %d = %+v", i+1, result)
+		}
+		refunded, err := orders.GetByID(ctx, order.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if refunded.Status != want || refunded.Refunded != uint(i+1) {
+			t.Errorf("after refund %d the order is %s with %d refunded, want %s", i+1, refunded.Status, refunded.Refunded, want)
+		}
+	}
+	if p, _ := server.Payment(created.ID); p.AmountRefunded != "5.00" {
+		t.Errorf("amount refunded = %q, want 5.00", p.AmountRefunded)
+	}
+	if _, err := settlement.Refund(ctx, order.ID, 1); !errors.Is(err, orders.ErrInvalidTransition) {
+		t.Errorf("refunding a refunded order returned %v, want %v", err, orders.ErrInvalidTransition)
+	}
+}
@@ -0,0 +1,351 @@
+package mollietest
+
+import (
+	"website/internal/payment"
+	"website/utils/money"
+
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// Payment represents a payment kept by the stand-in server
+type Payment struct {
+	ID             string
+	Status         string
+	Currency       string
+	Value          string
+	Description    string
+	RedirectURL    string
+	WebhookURL     string
+	AmountRefunded string
+}
+
+// Server is an offline stand-in for the Mollie API, including a checkout page
+// where payments can be completed by hand
+type Server struct {
+	*httptest.Server
+
+	apiKey        string
+	webhookSecret []byte
+	mu            sync.Mutex
+	next          int
+	payments      map[string]*Payment
+	refunds       map[string]map[string]interface{}
+}
+
+// checkoutPage lets the customer pick the outcome of a payment
+var checkoutPage = template.Must(template.New("checkout").Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="UTF-8"><title>Mollie test checkout</title></head>
+<body>
+    <h1>Test payment {{.ID}}</h1>
+    <p>{{.Description}}: &euro;{{.Value}}</p>
+    <form method="POST">
+        <button name="status" value="paid">Paid</button>
+        <button name="status" value="failed">Failed</button>
+        <button name="status" value="canceled">Canceled</button>
+        <button name="status" value="expired">Expired</button>
+    </form>
+</body>
+</html>`))
+
+// NewServer starts a stand-in server accepting requests authorized with apiKey.
+// The Mollie API is served under URL + "/v2". Webhooks are signed with webhookSecret when it is set.
+func NewServer(apiKey, webhookSecret string) *Server {
+	s := &Server{
+		apiKey:        apiKey,
+		webhookSecret: []byte(webhookSecret),
+		payments:      map[string]*Payment{},
+		refunds:       map[string]map[string]interface{}{},
+	}
+
+	router := mux.NewRouter()
+	api := router.PathPrefix("/v2").Subrouter()
+	api.Use(s.authenticate)
+	api.HandleFunc("/payments", s.createPayment).Methods(http.MethodPost)
+	api.HandleFunc("/payments/{id}", s.getPayment).Methods(http.MethodGet)
+	api.HandleFunc("/payments/{id}/refunds", s.createRefund).Methods(http.MethodPost)
+	router.HandleFunc("/checkout/{id}", s.checkout).Methods(http.MethodGet)
+	router.HandleFunc("/checkout/{id}", s.complete).Methods(http.MethodPost)
+
+	s.Server = httptest.NewServer(router)
+	return s
+}
+
+// APIURL returns the base URL of the stand-in Mollie API
+func (s *Server) APIURL() string {
+	return s.URL + "/v2"
+}
+
+// Payment returns a copy of a payment kept by the server
+func (s *Server) Payment(id string) (Payment, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	p, ok := s.payments[id]
+	if !ok {
+		return Payment{}, false
+	}
+	return *p, true
+}
+
+// SetStatus changes the status of a payment and notifies its webhook, like Mollie would
+func (s *Server) SetStatus(id, status string) error {
+	s.mu.Lock()
+	p, ok := s.payments[id]
+	if ok {
+		p.Status = status
+	}
+	s.mu.Unlock()
+
+	if !ok {
+		return fmt.Errorf("unknown payment %q", id)
+	}
+	return s.notify(p.WebhookURL, id)
+}
+
+// notify posts the payment ID to a webhook URL
+func (s *Server) notify(webhookURL, id string) error {
+	if webhookURL == "" {
+		return nil
+	}
+
+	// Create the webhook request
+	body := url.Values{"id": {id}}.Encode()
+	req, err := http.NewRequest(http.MethodPost, webhookURL, strings.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	// Sign the webhook request when a secret was configured
+	if len(s.webhookSecret) > 0 {
+		payment.SignRequest(req, s.webhookSecret, []byte(body), time.Now())
+	}
+
+	// Send the webhook request
+	client := &http.Client{Timeout: 10 * time.Second}
+	response, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return fmt.Errorf("webhook returned status %d", response.StatusCode)
+	}
+	return nil
+}
+
+// writeJSON writes a JSON response
+func writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/hal+json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
+
+// writeError writes an error the way the Mollie API does
+func writeError(w http.ResponseWriter, status int, detail string) {
+	writeJSON(w, status, map[string]interface{}{
+		"status": status,
+		"title":  http.StatusText(status),
+		"detail": detail,
+	})
+}
+
+// authenticate checks the API key of every API request
+func (s *Server) authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer "+s.apiKey {
+			writeError(w, http.StatusUnauthorized, "Missing authentication, or failed to authenticate")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// toJSON converts a payment into the object returned by the Mollie API
+func (s *Server) toJSON(p *Payment) map[string]interface{} {
+	body := map[string]interface{}{
+		"resource":    "payment",
+		"id":          p.ID,
+		"status":      p.Status,
+		"description": p.Description,
+		"redirectUrl": p.RedirectURL,
+		"webhookUrl":  p.WebhookURL,
+		"amount":      map[string]string{"currency": p.Currency, "value": p.Value},
+		"_links": map[string]interface{}{
+			"self": map[string]string{"href": fmt.Sprintf("%s/payments/%s", s.APIURL(), p.ID)},
+		},
+	}
+	if p.AmountRefunded != "" {
+		body["amountRefunded"] = map[string]string{"currency": p.Currency, "value": p.AmountRefunded}
+	}
+	if p.Status == "open" {
+		links := body["_links"].(map[string]interface{})
+		links["checkout"] = map[string]string{"href": fmt.Sprintf("%s/checkout/%s", s.URL, p.ID)}
+	}
+	return body
+}
+
+// createPayment handles POST /v2/payments
+func (s *Server) createPayment(w http.ResponseWriter, r *http.Request) {
+	var request struct {
+		Amount struct {
+			Currency string `json:"currency"`
+			Value    string `json:"value"`
+		} `json:"amount"`
+		Description string `json:"description"`
+		RedirectURL string `json:"redirectUrl"`
+		WebhookURL  string `json:"webhookUrl"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid JSON")
+		return
+	}
+	if request.Amount.Currency == "" || request.Amount.Value == "" {
+		writeError(w, http.StatusUnprocessableEntity, "The amount is required")
+		return
+	}
+
+	s.mu.Lock()
+	s.next++
+	p := &Payment{
+		ID:          fmt.Sprintf("tr_test%06d", s.next),
+		Status:      "open",
+		Currency:    request.Amount.Currency,
+		Value:       request.Amount.Value,
+		Description: request.Description,
+		RedirectURL: request.RedirectURL,
+		WebhookURL:  request.WebhookURL,
+	}
+	s.payments[p.ID] = p
+	body := s.toJSON(p)
+	s.mu.Unlock()
+
+	writeJSON(w, http.StatusCreated, body)
+}
+
+// getPayment handles GET /v2/payments/{id}
+func (s *Server) getPayment(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	p, ok := s.payments[mux.Vars(r)["id"]]
+	if !ok {
+		writeError(w, http.StatusNotFound, "No payment exists with this token.")
+		return
+	}
+	writeJSON(w, http.StatusOK, s.toJSON(p))
+}
+
+// createRefund handles POST /v2/payments/{id}/refunds
+func (s *Server) createRefund(w http.ResponseWriter, r *http.Request) {
+	var request struct {
+		Amount struct {
+			Currency string `json:"currency"`
+			Value    string `json:"value"`
+		} `json:"amount"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid JSON")
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	p, ok := s.payments[mux.Vars(r)["id"]]
+	if !ok {
+		writeError(w, http.StatusNotFound, "No payment exists with this token.")
+		return
+	}
+	if p.Status != "paid" {
+		writeError(w, http.StatusUnprocessableEntity, "The payment cannot be refunded")
+		return
+	}
+
+	// Answer a repeated request with the refund that was already made
+	key := r.Header.Get("Idempotency-Key")
+	if refund, ok := s.refunds[p.ID+"/"+key]; ok && key != "" {
+		writeJSON(w, http.StatusCreated, refund)
+		return
+	}
+
+	// Add the refund to what was refunded before, which may never exceed the payment
+	refund, err := money.Parse(request.Amount.Value, request.Amount.Currency)
+	if err != nil || refund.Currency != p.Currency || refund.Amount <= 0 {
+		writeError(w, http.StatusUnprocessableEntity, "The amount is invalid")
+		return
+	}
+	refunded := money.New(0, p.Currency)
+	if p.AmountRefunded != "" {
+		refunded, _ = money.Parse(p.AmountRefunded, p.Currency)
+	}
+	paid, _ := money.Parse(p.Value, p.Currency)
+	total, _ := refunded.Add(refund)
+	if total.Amount > paid.Amount {
+		writeError(w, http.StatusUnprocessableEntity, "The amount is higher than the amount that can be refunded")
+		return
+	}
+
+	p.AmountRefunded = total.String()
+	s.next++
+	body := map[string]interface{}{
+		"resource":  "refund",
+		"id":        fmt.Sprintf("re_test%06d", s.next),
+		"paymentId": p.ID,
+		"status":    "pending",
+		"amount":    map[string]string{"currency": request.Amount.Currency, "value": request.Amount.Value},
+	}
+	if key != "" {
+		s.refunds[p.ID+"/"+key] = body
+	}
+	writeJSON(w, http.StatusCreated, body)
+}
+
+// checkout handles GET /checkout/{id}
+func (s *Server) checkout(w http.ResponseWriter, r *http.Request) {
+	p, ok := s.Payment(mux.Vars(r)["id"])
+	if !ok {
+		http.Error(w, "Unknown payment", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html")
+	checkoutPage.Execute(w, p)
+}
+
+// complete handles POST /checkout/{id}, settling the payment and sending the customer back
+func (s *Server) complete(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	p, ok := s.Payment(id)
+	if !ok || p.Status != "open" {
+		http.Error(w, "Payment cannot be completed", http.StatusBadRequest)
+		return
+	}
+
+	status := r.FormValue("status")
+	switch status {
+	case "paid", "failed", "canceled", "expired":
+	default:
+		http.Error(w, "Unknown status", http.StatusBadRequest)
+		return
+	}
+
+	if err := s.SetStatus(id, status); err != nil {
+		log.Printf("[Warning] mollie test server failed to call the webhook: %v", err)
+	}
+
+	http.Redirect(w, r, p.RedirectURL, http.StatusSeeOther)
+}
@@ -0,0 +1,81 @@
+package payment
+
+import (
+	"website/utils/database/models/orders"
+	"website/utils/money"
+
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+)
+
+var (
+	// ErrNotSupported is returned when a provider does not offer an operation
+	ErrNotSupported = errors.New("operation is not supported by the payment provider")
+
+	// ErrDeclined is returned when the provider refused a request, so nothing was changed
+	ErrDeclined = errors.New("request was declined by the payment provider")
+
+	// ErrUnauthorized is returned when a webhook request could not be authenticated
+	ErrUnauthorized = errors.New("webhook request is not authorized")
+)
+
+// Input describes a payment that should be created at the payment provider
+type Input struct {
+	Reference   string
+	Description string
+	Amount      money.Money
+	WebhookURL  string
+	RedirectURL string
+}
+
+// Payment describes a payment as it is known by the payment provider
+type Payment struct {
+	ID          string
+	CheckoutURL string
+	Status      orders.Status
+	Amount      money.Money
+}
+
+// WebhookEvent describes a status update received from the payment provider.
+// PaymentID is empty when the provider identifies the payment by the webhook URL only.
+type WebhookEvent struct {
+	PaymentID string
+	Status    orders.Status
+}
+
+// Provider is implemented by every payment gateway the website can take payments with
+type Provider interface {
+	// CreatePayment registers a payment and returns where the customer can complete it
+	CreatePayment(ctx context.Context, input Input) (*Payment, error)
+
+	// ParseWebhook authenticates a webhook request and extracts the status update from it
+	ParseWebhook(r *http.Request) (*WebhookEvent, error)
+
+	// Refund returns an amount of a completed payment to the customer. Refunds sent again
+	// with the same idempotency key are only made once, so a failed call can be retried.
+	Refund(ctx context.Context, paymentID string, amount money.Money, idempotencyKey string) error
+
+	// GetStatus asks the provider for the current state of a payment
+	GetStatus(ctx context.Context, paymentID string) (*Payment, error)
+}
+
+var (
+	provider   Provider
+	providerMu sync.Mutex
+)
+
+// Use sets the provider that is used for all payments
+func Use(p Provider) {
+	providerMu.Lock()
+	defer providerMu.Unlock()
+	provider = p
+}
+
+// Get returns the provider that is used for all payments
+func Get() Provider {
+	providerMu.Lock()
+	defer providerMu.Unlock()
+	return provider
+}
@@ -0,0 +1,119 @@
+package payment
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestSign(t *testing.T) {
+	secret := []byte("secret")
+	body := []byte(`{"id":"tr_1"}`)
+	signature := Sign(secret, 1700000000, http.MethodPost, "/order/1", body)
+
+	tests := []struct {
+		name      string
+		secret    []byte
+		timestamp int64
+		method    string
+		path      string
+		body      []byte
+	}{
+		{"other secret", []byte("other"), 1700000000, http.MethodPost, "/order/1", body},
+		{"other timestamp", secret, 1700000001, http.MethodPost, "/order/1", body},
+		{"other method", secret, 1700000000, http.MethodPut, "/order/1", body},
+		{"other path", secret, 1700000000, http.MethodPost, "/order/2", body},
+		{"other query", secret, 1700000000, http.MethodPost, "/order/1?id=2", body},
+		{"other body", secret, 1700000000, http.MethodPost, "/order/1", []byte(`{"id":"tr_2"}`)},
+	}
+
+	if again := Sign(secret, 1700000000, http.MethodPost, "/order/1", body); again != signature {
+		t.Fatalf("Sign is not deterministic: %s != %s", again, signature)
+	}
+	for _, test := range tests {
+		if Sign(test.secret, test.timestamp, test.method, test.path, test.body) == signature {
+			t.Errorf("%s: signature did not change", test.name)
+		}
+	}
+}
+
+func TestVerifyRequest(t *testing.T) {
+	secret := []byte("secret")
+	body := []byte(`{"id":"tr_1"}`)
+	now := time.Unix(1700000000, 0)
+
+	// newRequest builds a webhook request signed at a moment
+	newRequest := func(signedAt time.Time) *http.Request {
+		req := httptest.NewRequest(http.MethodPost, "http://example.com/order/1", bytes.NewReader(body))
+		SignRequest(req, secret, body, signedAt)
+		return req
+	}
+
+	tests := []struct {
+		name    string
+		request func() *http.Request
+		secret  []byte
+		wantErr bool
+	}{
+		{"valid", func() *http.Request { return newRequest(now) }, secret, false},
+		{"inside window", func() *http.Request { return newRequest(now.Add(-DefaultReplayWindow)) }, secret, false},
+		{"too old", func() *http.Request { return newRequest(now.Add(-DefaultReplayWindow - time.Second)) }, secret, true},
+		{"from the future", func() *http.Request { return newRequest(now.Add(DefaultReplayWindow + time.Second)) }, secret, true},
+		{"wrong secret", func() *http.Request { return newRequest(now) }, []byte("other"), true},
+		{"no secret", func() *http.Request { return newRequest(now) }, nil, true},
+		{"unsigned", func() *http.Request {
+			return httptest.NewRequest(http.MethodPost, "/order/1", bytes.NewReader(body))
+		}, secret, true},
+		{"changed body", func() *http.Request {
+			req := newRequest(now)
+			req.Body = io.NopCloser(bytes.NewReader([]byte(`{"id":"tr_2"}`)))
+			return req
+		}, secret, true},
+		{"replayed on another order", func() *http.Request {
+			replayed := httptest.NewRequest(http.MethodPost, "/order/2", bytes.NewReader(body))
+			replayed.Header = newRequest(now).Header
+			return replayed
+		}, secret, true},
+		{"replayed with another method", func() *http.Request {
+			replayed := httptest.NewRequest(http.MethodPut, "/order/1", bytes.NewReader(body))
+			replayed.Header = newRequest(now).Header
+			return replayed
+		}, secret, true},
+		{"changed timestamp", func() *http.Request {
+			req := newRequest(now)
+			req.Header.Set(TimestampHeader, strconv.FormatInt(now.Unix()+1, 10))
+			return req
+		}, secret, true},
+		{"invalid signature", func() *http.Request {
+			req := newRequest(now)
+			req.Header.Set(SignatureHeader, "not hex")
+			return req
+		}, secret, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req := test.request()
+			err := VerifyRequest(req, test.secret, DefaultReplayWindow, now)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("VerifyRequest error = %v, want error %v", err, test.wantErr)
+			}
+			if err != nil && !errors.Is(err, ErrUnauthorized) {
+				t.Errorf("VerifyRequest error = %v, want %v", err, ErrUnauthorized)
+			}
+
+			// The body can be read again after a successful verification
+			if err == nil {
+				restored, _ := io.ReadAll(req.Body)
+				if !bytes.Equal(restored, body) {
+					t.Errorf("body after verification = %q, want %q", restored, body)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,234 @@
+package pricing
+
+import (
+	"website/utils/database/models/products"
+	"website/utils/money"
+
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Rule describes a price change that applies to some products during some time.
+// A rule either gives a percentage discount, sets a fixed unit price, or lets every
+// Buy drinks cost the price of Pay drinks.
+type Rule struct {
+	Name        string   `json:"name"`
+	Products    []string `json:"products,omitempty"`
+	Weekdays    []string `json:"weekdays,omitempty"`
+	From        string   `json:"from,omitempty"`
+	Until       string   `json:"until,omitempty"`
+	MinQuantity uint     `json:"min_quantity,omitempty"`
+	Discount    uint     `json:"discount_percent,omitempty"`
+	Price       string   `json:"price,omitempty"`
+	Buy         uint     `json:"buy,omitempty"`
+	Pay         uint     `json:"pay,omitempty"`
+
+	from, until int
+	days        map[time.Weekday]bool
+}
+
+// Quote is the price of an order together with the rule that produced it
+type Quote struct {
+	UnitPrice money.Money
+	Total     money.Money
+	Rule      string
+}
+
+var (
+	rules   []Rule
+	rulesMu sync.Mutex
+)
+
+// weekdays maps the names used in rule files onto weekdays
+var weekdays = map[string]time.Weekday{
+	"sunday":    time.Sunday,
+	"monday":    time.Monday,
+	"tuesday":   time.Tuesday,
+	"wednesday": time.Wednesday,
+	"thursday":  time.Thursday,
+	"friday":    time.Friday,
+	"saturday":  time.Saturday,
+}
+
+// parseClock converts a time of day such as "16:30" into minutes after midnight
+func parseClock(value string) (int, error) {
+	clock, err := time.Parse("15:04", value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid time of day %q", value)
+	}
+	return clock.Hour()*60 + clock.Minute(), nil
+}
+
+// prepare validates a rule and parses its time window
+func (r *Rule) prepare() error {
+	if r.Name == "" {
+		return errors.New("rule is missing a name")
+	}
+
+	// Exactly one kind of price change must be set
+	kinds := 0
+	if r.Discount > 0 {
+		kinds++
+		if r.Discount > 100 {
+			return fmt.Errorf("rule %q: discount must be at most 100 percent", r.Name)
+		}
+	}
+	if r.Price != "" {
+		kinds++
+		price, err := money.Parse(r.Price, "EUR")
+		if err != nil {
+			return fmt.Errorf("rule %q: %v", r.Name, err)
+		}
+		if price.Amount <= 0 {
+			return fmt.Errorf("rule %q: price must be positive", r.Name)
+		}
+	}
+	if r.Buy > 0 || r.Pay > 0 {
+		kinds++
+		if r.Pay == 0 || r.Buy <= r.Pay {
+			return fmt.Errorf("rule %q: buy must be larger than pay", r.Name)
+		}
+	}
+	if kinds != 1 {
+		return fmt.Errorf("rule %q: set exactly one of discount_percent, price or buy/pay", r.Name)
+	}
+
+	// Parse the time window, an empty window lasts all day
+	r.from, r.until = 0, 24*60
+	var err error
+	if r.From != "" {
+		if r.from, err = parseClock(r.From); err != nil {
+			return fmt.Errorf("rule %q: %v", r.Name, err)
+		}
+	}
+	if r.Until != "" {
+		if r.until, err = parseClock(r.Until); err != nil {
+			return fmt.Errorf("rule %q: %v", r.Name, err)
+		}
+	}
+
+	// Parse the weekdays, no weekdays means every day
+	r.days = map[time.Weekday]bool{}
+	for _, name := range r.Weekdays {
+		day, ok := weekdays[strings.ToLower(name)]
+		if !ok {
+			return fmt.Errorf("rule %q: invalid weekday %q", r.Name, name)
+		}
+		r.days[day] = true
+	}
+
+	return nil
+}
+
+// onDay reports whether the rule applies on a weekday
+func (r *Rule) onDay(day time.Weekday) bool {
+	return len(r.days) == 0 || r.days[day]
+}
+
+// activeAt reports whether the time window of the rule contains a moment.
+// Windows that end before they start run past midnight and belong to the day they start on.
+func (r *Rule) activeAt(now time.Time) bool {
+	minute := now.Hour()*60 + now.Minute()
+	if r.from <= r.until {
+		return r.onDay(now.Weekday()) && minute >= r.from && minute < r.until
+	}
+	if minute >= r.from {
+		return r.onDay(now.Weekday())
+	}
+	return minute < r.until && r.onDay(now.AddDate(0, 0, -1).Weekday())
+}
+
+// appliesTo reports whether the rule covers a product, matched by ID or by name
+func (r *Rule) appliesTo(product products.Product) bool {
+	if len(r.Products) == 0 {
+		return true
+	}
+	for _, p := range r.Products {
+		if p == product.ID.Hex() || strings.EqualFold(p, product.Name) {
+			return true
+		}
+	}
+	return false
+}
+
+// total computes what a quantity costs under the rule
+func (r *Rule) total(price money.Money, quantity uint) (money.Money, error) {
+	switch {
+	case r.Discount > 0:
+		listed := price.Times(quantity)
+		return money.New((listed.Amount*int64(100-r.Discount)+50)/100, price.Currency), nil
+	case r.Price != "":
+		unit, err := money.Parse(r.Price, price.Currency)
+		if err != nil {
+			return money.Money{}, fmt.Errorf("rule %q: %v", r.Name, err)
+		}
+		return unit.Times(quantity), nil
+	default:
+		charged := quantity/r.Buy*r.Pay + quantity%r.Buy
+		return price.Times(charged), nil
+	}
+}
+
+// Load reads the pricing rules from a JSON file. A missing file means there are no rules.
+func Load(filename string) error {
+	// Read the rules file
+	data, err := os.ReadFile(filename)
+	if errors.Is(err, os.ErrNotExist) {
+		data = []byte(`{"rules": []}`)
+	} else if err != nil {
+		return err
+	}
+
+	// Parse and validate the rules
+	var file struct {
+		Rules []Rule `json:"rules"`
+	}
+	if err := json.Unmarshal(data, &file); err != nil {
+		return err
+	}
+	for i := range file.Rules {
+		if err := file.Rules[i].prepare(); err != nil {
+			return err
+		}
+	}
+
+	// Store the rules
+	rulesMu.Lock()
+	defer rulesMu.Unlock()
+	rules = file.Rules
+
+	return nil
+}
+
+// Price quotes a quantity of a product at a moment in time. Of all rules that apply,
+// the one giving the lowest total is used; without any rule the listed price is charged.
+func Price(product products.Product, quantity uint, now time.Time) Quote {
+	rulesMu.Lock()
+	defer rulesMu.Unlock()
+
+	// Start from the listed price
+	quote := Quote{
+		UnitPrice: product.Price,
+		Total:     product.Price.Times(quantity),
+	}
+
+	// Find the cheapest rule that applies
+	for _, rule := range rules {
+		if !rule.appliesTo(product) || !rule.activeAt(now) || quantity < rule.MinQuantity {
+			continue
+		}
+		total, err := rule.total(product.Price, quantity)
+		if err != nil || total.Amount >= quote.Total.Amount {
+			continue
+		}
+		quote.Total = total
+		quote.Rule = rule.Name
+	}
+
+	return quote
+}
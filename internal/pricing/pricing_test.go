@@ -0,0 +1,118 @@
+package pricing
+
+import (
+	"website/utils/database/models/products"
+	"website/utils/money"
+
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// testRules covers every kind of rule, including a window that runs past midnight
+const testRules = `{
+	"rules": [
+		{"name": "Happy hour", "weekdays": ["thursday", "friday"], "from": "17:00", "until": "19:00", "discount_percent": 25},
+		{"name": "10 for 9", "products": ["Beer"], "buy": 10, "pay": 9},
+		{"name": "Night cola", "products": ["cola"], "weekdays": ["Friday"], "from": "23:00", "until": "02:00", "price": "1.00"},
+		{"name": "Bulk", "min_quantity": 20, "discount_percent": 30}
+	]
+}`
+
+// writeRules stores rules in a temporary file and returns its path
+func writeRules(t *testing.T, data string) string {
+	t.Helper()
+	filename := filepath.Join(t.TempDir(), "pricing.json")
+	if err := os.WriteFile(filename, []byte(data), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return filename
+}
+
+func TestPrice(t *testing.T) {
+	if err := Load(writeRules(t, testRules)); err != nil {
+		t.Fatal(err)
+	}
+	defer Load(filepath.Join(t.TempDir(), "missing.json"))
+
+	beer := products.Product{ID: primitive.NewObjectID(), Name: "Beer", Price: money.New(200, "EUR")}
+	cola := products.Product{ID: primitive.NewObjectID(), Name: "Cola", Price: money.New(150, "EUR")}
+
+	// 2024-01-03 is a Wednesday
+	at := func(day, hour, minute int) time.Time {
+		return time.Date(2024, time.January, day, hour, minute, 0, 0, time.UTC)
+	}
+
+	tests := []struct {
+		name     string
+		product  products.Product
+		quantity uint
+		now      time.Time
+		total    int64
+		rule     string
+	}{
+		{"listed price", beer, 1, at(3, 12, 0), 200, ""},
+		{"happy hour", beer, 2, at(4, 18, 0), 300, "Happy hour"},
+		{"happy hour starts", beer, 2, at(4, 17, 0), 300, "Happy hour"},
+		{"happy hour ended", beer, 2, at(4, 19, 0), 400, ""},
+		{"happy hour on other day", beer, 2, at(3, 18, 0), 400, ""},
+		{"buy pay", beer, 10, at(3, 12, 0), 1800, "10 for 9"},
+		{"buy pay with remainder", beer, 19, at(3, 12, 0), 3600, "10 for 9"},
+		{"cheapest rule wins", beer, 10, at(4, 18, 0), 1500, "Happy hour"},
+		{"other product", cola, 10, at(3, 12, 0), 1500, ""},
+		{"fixed price", cola, 2, at(5, 23, 30), 200, "Night cola"},
+		{"fixed price past midnight", cola, 2, at(6, 1, 0), 200, "Night cola"},
+		{"past midnight on wrong day", cola, 2, at(7, 1, 0), 300, ""},
+		{"minimum quantity", beer, 20, at(3, 12, 0), 2800, "Bulk"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			quote := Price(test.product, test.quantity, test.now)
+			if quote.Total.Amount != test.total || quote.Rule != test.rule {
+				t.Errorf("Price = %d (%q), want %d (%q)", quote.Total.Amount, quote.Rule, test.total, test.rule)
+			}
+			if !quote.UnitPrice.Equal(test.product.Price) {
+				t.Errorf("unit price = %v, want %v", quote.UnitPrice, test.product.Price)
+			}
+		})
+	}
+}
+
+func TestLoad(t *testing.T) {
+	tests := []struct {
+		name    string
+		rules   string
+		wantErr bool
+	}{
+		{"valid", testRules, false},
+		{"no rules", `{"rules": []}`, false},
+		{"missing name", `{"rules": [{"discount_percent": 10}]}`, true},
+		{"no price change", `{"rules": [{"name": "a"}]}`, true},
+		{"two price changes", `{"rules": [{"name": "a", "discount_percent": 10, "price": "1.00"}]}`, true},
+		{"discount above 100", `{"rules": [{"name": "a", "discount_percent": 101}]}`, true},
+		{"buy not above pay", `{"rules": [{"name": "a", "buy": 2, "pay": 2}]}`, true},
+		{"invalid price", `{"rules": [{"name": "a", "price": "1,00"}]}`, true},
+		{"zero price", `{"rules": [{"name": "a", "price": "0.00"}]}`, true},
+		{"invalid time", `{"rules": [{"name": "a", "discount_percent": 10, "from": "25:00"}]}`, true},
+		{"invalid weekday", `{"rules": [{"name": "a", "discount_percent": 10, "weekdays": ["someday"]}]}`, true},
+		{"invalid json", `{"rules": [`, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := Load(writeRules(t, test.rules))
+			if (err != nil) != test.wantErr {
+				t.Errorf("Load error = %v, want error %v", err, test.wantErr)
+			}
+		})
+	}
+
+	// A missing file means there are no rules
+	if err := Load(filepath.Join(t.TempDir(), "missing.json")); err != nil {
+		t.Errorf("Load of a missing file: %v", err)
+	}
+}
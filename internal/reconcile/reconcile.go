@@ -0,0 +1,197 @@
+package reconcile
+
+import (
+	"website/internal/payment"
+	"website/utils/database/models/ledger"
+	"website/utils/database/models/orders"
+	"website/utils/money"
+
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Issue describes a single way in which an order, its payment and its card disagree
+type Issue string
+
+const (
+	IssuePaidNotCredited = Issue("paid_not_credited") // The payment was paid, but the card never received the beers
+	IssueCreditedNotPaid = Issue("credited_not_paid") // The card received beers, but the payment did not succeed
+	IssueAmountMismatch  = Issue("amount_mismatch")   // The provider charged a different amount than the order total
+	IssueStatusMismatch  = Issue("status_mismatch")   // The provider reports a different final status than the order
+	IssueProviderError   = Issue("provider_error")    // The provider could not be asked about the payment
+)
+
+// Finding describes an order for which at least one issue was found
+type Finding struct {
+	OrderID        string        `json:"order_id"`
+	PaymentID      string        `json:"payment_id"`
+	OrderDate      time.Time     `json:"order_date"`
+	OrderStatus    orders.Status `json:"order_status"`
+	ProviderStatus orders.Status `json:"provider_status,omitempty"`
+	OrderAmount    money.Money   `json:"order_amount"`
+	ProviderAmount *money.Money  `json:"provider_amount,omitempty"`
+	Quantity       uint          `json:"quantity"`
+	Credited       int64         `json:"credited"`
+	Issues         []Issue       `json:"issues"`
+	Error          string        `json:"error,omitempty"`
+}
+
+// Report summarizes the reconciliation of all orders placed within a period of time
+type Report struct {
+	From       time.Time `json:"from"`
+	To         time.Time `json:"to"`
+	Checked    int       `json:"checked"`
+	Unverified int       `json:"unverified"`
+	Findings   []Finding `json:"findings"`
+}
+
+// add records an issue once
+func (f *Finding) add(issue Issue) {
+	for _, existing := range f.Issues {
+		if existing == issue {
+			return
+		}
+	}
+	f.Issues = append(f.Issues, issue)
+}
+
+// ParsePeriod parses an inclusive range of dates written as YYYY-MM-DD. Missing dates default
+// to the last seven days. The returned end is exclusive, so it can be passed to Run directly.
+func ParsePeriod(fromValue, toValue string) (time.Time, time.Time, error) {
+	now := time.Now()
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.Local)
+
+	// Parse the last day of the period
+	to := today
+	if toValue != "" {
+		parsed, err := time.ParseInLocation("2006-01-02", toValue, time.Local)
+		if err != nil {
+			return time.Time{}, time.Time{}, fmt.Errorf("invalid end date %q", toValue)
+		}
+		to = parsed
+	}
+
+	// Parse the first day of the period
+	from := to.AddDate(0, 0, -6)
+	if fromValue != "" {
+		parsed, err := time.ParseInLocation("2006-01-02", fromValue, time.Local)
+		if err != nil {
+			return time.Time{}, time.Time{}, fmt.Errorf("invalid start date %q", fromValue)
+		}
+		from = parsed
+	}
+
+	// Include the whole last day
+	to = to.AddDate(0, 0, 1)
+	if !from.Before(to) {
+		return time.Time{}, time.Time{}, fmt.Errorf("start date must not be after the end date")
+	}
+
+	return from, to, nil
+}
+
+// isFailed reports whether a status means that no money was received
+func isFailed(status orders.Status) bool {
+	return status == orders.StatusFailed || status == orders.StatusCancelled || status == orders.StatusExpired
+}
+
+// isRefund reports whether a status belongs to a paid order that is being or was refunded
+func isRefund(status orders.Status) bool {
+	return status == orders.StatusRefunding || status == orders.StatusRefunded
+}
+
+// check compares a single order with its payment and the ledger of its card
+func check(ctx context.Context, order orders.Order, report *Report) (*Finding, error) {
+	finding := Finding{
+		OrderID:     order.ID.Hex(),
+		PaymentID:   order.PaymentID,
+		OrderDate:   order.OrderDate,
+		OrderStatus: order.Status,
+		OrderAmount: order.TotalAmount,
+		Quantity:    order.Quantity,
+	}
+
+	// Find out how many beers the order credited to the card
+	credited, err := ledger.SumByReference(ctx, ledger.ReasonOrder, order.ID.Hex())
+	if err != nil {
+		return nil, err
+	}
+	finding.Credited = credited
+
+	// Compare the order with its own ledger entries
+	if order.Status == orders.StatusPaid && credited != int64(order.Quantity) {
+		finding.add(IssuePaidNotCredited)
+	}
+	if credited > 0 && order.Status != orders.StatusPaid && !isRefund(order.Status) {
+		finding.add(IssueCreditedNotPaid)
+	}
+
+	// Ask the payment provider about the payment
+	var current *payment.Payment
+	if order.PaymentID == "" {
+		err = payment.ErrNotSupported
+	} else {
+		current, err = payment.Get().GetStatus(ctx, order.PaymentID)
+	}
+	if errors.Is(err, payment.ErrNotSupported) {
+		report.Unverified++
+	} else if err != nil {
+		finding.add(IssueProviderError)
+		finding.Error = err.Error()
+	} else {
+		finding.ProviderStatus = current.Status
+		finding.ProviderAmount = &current.Amount
+
+		// Compare the order with the payment
+		paid := current.Status == orders.StatusPaid
+		if paid && credited <= 0 && !isRefund(order.Status) {
+			finding.add(IssuePaidNotCredited)
+		}
+		if isFailed(current.Status) && credited > 0 {
+			finding.add(IssueCreditedNotPaid)
+		}
+		if current.Status != orders.StatusPending && order.Status != current.Status &&
+			!(paid && isRefund(order.Status)) {
+			finding.add(IssueStatusMismatch)
+		}
+		if !current.Amount.Equal(order.TotalAmount) {
+			finding.add(IssueAmountMismatch)
+		}
+	}
+
+	if len(finding.Issues) == 0 {
+		return nil, nil
+	}
+	return &finding, nil
+}
+
+// Run reconciles all orders placed from (inclusive) to (exclusive)
+func Run(ctx context.Context, from, to time.Time) (*Report, error) {
+	report := &Report{
+		From:     from,
+		To:       to,
+		Findings: []Finding{},
+	}
+
+	// Get the orders placed in the period
+	found, err := orders.GetBetween(ctx, from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	// Check every order
+	for _, order := range found {
+		finding, err := check(ctx, order, report)
+		if err != nil {
+			return nil, err
+		}
+		if finding != nil {
+			report.Findings = append(report.Findings, *finding)
+		}
+		report.Checked++
+	}
+
+	return report, nil
+}
@@ -0,0 +1,557 @@
+package settlement
+
+import (
+	"website/internal/payment"
+	"website/utils/database"
+	"website/utils/database/models/cards"
+	"website/utils/database/models/ledger"
+	"website/utils/database/models/orders"
+	"website/utils/database/models/pours"
+	"website/utils/database/models/vouchers"
+	"website/utils/money"
+
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var (
+	// ErrInvalidRefund is returned when more beers are refunded than are left on the order
+	ErrInvalidRefund = errors.New("cannot refund more beers than are left on the order")
+
+	// ErrRefundInProgress is returned when another refund of the order was started but not finished
+	ErrRefundInProgress = errors.New("another refund of this order is still in progress")
+
+	// ErrSameCard is returned when beers are transferred from a card to itself
+	ErrSameCard = errors.New("cannot transfer beers to the same card")
+
+	// ErrNoChange is returned when a balance is adjusted by zero beers
+	ErrNoChange = errors.New("adjustment does not change the balance")
+
+	// ErrNotBlocked is returned when beers are moved off a card that was not blocked
+	ErrNotBlocked = errors.New("card is not blocked")
+
+	// ErrNoReplacement is returned when a blocked card does not know the card replacing it
+	ErrNoReplacement = errors.New("blocked card has no replacement")
+
+	// ErrNothingToMove is returned when a blocked card has no beers left to move
+	ErrNothingToMove = errors.New("blocked card has no beers to move")
+
+	// ErrOpenOrders is returned when a card is deleted while it has orders waiting for a payment or refund
+	ErrOpenOrders = errors.New("card has orders that are not settled yet")
+)
+
+// RefundResult describes what a refund returned to the customer and took from the card
+type RefundResult struct {
+	Beers     uint        `json:"beers"`
+	Amount    money.Money `json:"amount"`
+	Debited   uint        `json:"debited"`
+	Remaining uint        `json:"remaining"`
+}
+
+// Settle moves a pending order to its final status in a single transaction, crediting the card
+// only when the order was paid. Settling an order twice returns orders.ErrAlreadyProcessed
+// without crediting the card again.
+func Settle(ctx context.Context, orderID primitive.ObjectID, status orders.Status) error {
+	return database.WithTransaction(ctx, func(ctx context.Context) error {
+		// Get the order details from the database
+		order, err := orders.GetByID(ctx, orderID)
+		if err != nil {
+			return err
+		}
+
+		// Only pending orders can be settled
+		if order.Status != orders.StatusPending {
+			return orders.ErrAlreadyProcessed
+		}
+
+		// A payment that is still open leaves the order untouched
+		if status == orders.StatusPending {
+			return nil
+		}
+
+		// Claim the order, this fails when another delivery already settled it
+		if err := orders.Transition(ctx, orderID, orders.StatusPending, status); err != nil {
+			return err
+		}
+
+		// Only paid orders add beers to the card
+		if status != orders.StatusPaid {
+			return nil
+		}
+
+		// Credit the beers to the card
+		if err := cards.Credit(ctx, order.CardID, order.ProductID, order.Quantity); err != nil {
+			return err
+		}
+
+		// Write the credit to the history of the card
+		entry := ledger.NewCredit(order.CardID, order.ProductID, ledger.ReasonOrder, order.Quantity, order.ID.Hex())
+		_, err = ledger.Insert(ctx, &entry)
+		return err
+	})
+}
+
+// Refund refunds beers of a paid order through the payment provider. A zero number of beers refunds
+// everything that was not refunded yet. The order only moves to Refunded once all its beers were
+// refunded, so it can be refunded partially more than once. The beers are taken back from the card
+// as far as its balance allows, so the balance never drops below zero.
+//
+// The provider is called outside of any transaction, since transactions may be retried: the order
+// is first claimed as Refunding, then refunded at the provider with an idempotency key, and finally
+// finished. When that is interrupted, calling Refund again finishes the claimed refund with the same
+// key instead of starting another one.
+func Refund(ctx context.Context, orderID primitive.ObjectID, beers uint) (*RefundResult, error) {
+	// Claim the order, or pick up a refund that was claimed before
+	order, err := claimRefund(ctx, orderID, beers)
+	if err != nil {
+		return nil, err
+	}
+
+	// Refund the payment, the key makes sure it is refunded only once however often this runs
+	err = payment.Get().Refund(ctx, order.PaymentID, order.RefundingAmount, order.RefundKey)
+	if errors.Is(err, payment.ErrNotSupported) || errors.Is(err, payment.ErrDeclined) {
+		// Nothing was refunded, so the order can be refunded again later
+		if releaseErr := orders.ReleaseRefund(ctx, orderID, order.RefundKey); releaseErr != nil {
+			return nil, releaseErr
+		}
+		return nil, err
+	} else if err != nil {
+		return nil, err
+	}
+
+	// Record the refund and take the beers back
+	return finishRefund(ctx, orderID, order.RefundKey)
+}
+
+// claimRefund moves a paid order to Refunding for a number of beers and returns it. An order that is
+// already Refunding is returned as it is, so its refund can be finished.
+func claimRefund(ctx context.Context, orderID primitive.ObjectID, beers uint) (*orders.Order, error) {
+	var claimed *orders.Order
+	err := database.WithTransaction(ctx, func(ctx context.Context) error {
+		// Get the order details from the database
+		order, err := orders.GetByID(ctx, orderID)
+		if err != nil {
+			return err
+		}
+
+		// Pick up a refund that was claimed but not finished
+		if order.Status == orders.StatusRefunding {
+			if beers != 0 && beers != order.Refunding {
+				return ErrRefundInProgress
+			}
+			claimed = order
+			return nil
+		}
+
+		// Only paid orders can be refunded
+		if !order.Status.CanTransitionTo(orders.StatusRefunding) {
+			return orders.ErrInvalidTransition
+		}
+
+		// Work out how much to refund, a partial refund pays back its share of the total
+		// and the last one pays back whatever is left, so no cents are lost to rounding
+		var remaining uint
+		if order.Refunded < order.Quantity {
+			remaining = order.Quantity - order.Refunded
+		}
+		refund := beers
+		if refund == 0 {
+			refund = remaining
+		}
+		if refund == 0 || refund > remaining {
+			return ErrInvalidRefund
+		}
+		amount := money.New(order.TotalAmount.Amount*int64(refund)/int64(order.Quantity), order.TotalAmount.Currency)
+		if refund == remaining {
+			amount.Amount = order.TotalAmount.Amount - order.RefundedAmount.Amount
+		}
+
+		// Claim the order, this fails when another refund claimed it first. The key names this
+		// refund by the beers refunded before it, so it stays the same when the refund is retried.
+		key := fmt.Sprintf("refund-%s-%d", order.ID.Hex(), order.Refunded)
+		if err := orders.ClaimRefund(ctx, orderID, refund, amount, key); err != nil {
+			return err
+		}
+
+		order.Status = orders.StatusRefunding
+		order.Refunding = refund
+		order.RefundingAmount = amount
+		order.RefundKey = key
+		claimed = order
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return claimed, nil
+}
+
+// finishRefund records the claimed refund of an order and takes its beers back from the card
+func finishRefund(ctx context.Context, orderID primitive.ObjectID, key string) (*RefundResult, error) {
+	var result RefundResult
+	err := database.WithTransaction(ctx, func(ctx context.Context) error {
+		// Get the order details from the database
+		order, err := orders.GetByID(ctx, orderID)
+		if err != nil {
+			return err
+		}
+
+		// Another call may have finished this refund already
+		if order.Status != orders.StatusRefunding || order.RefundKey != key {
+			return orders.ErrAlreadyProcessed
+		}
+		if err := orders.FinishRefund(ctx, order); err != nil {
+			return err
+		}
+
+		// Take back as many beers as the card still has
+		card, err := cards.GetByID(ctx, order.CardID)
+		if err != nil {
+			return err
+		}
+		debit := order.Refunding
+		if balance := card.Balance(order.ProductID); balance < debit {
+			debit = balance
+		}
+		if debit > 0 {
+			if err := cards.Debit(ctx, card.ID, order.ProductID, debit); err != nil {
+				return err
+			}
+
+			// Write the debit to the history of the card
+			entry := ledger.NewDebit(card.ID, order.ProductID, ledger.ReasonRefund, debit, order.ID.Hex())
+			if _, err := ledger.Insert(ctx, &entry); err != nil {
+				return err
+			}
+		}
+
+		result = RefundResult{
+			Beers:     order.Refunding,
+			Amount:    order.RefundingAmount,
+			Debited:   debit,
+			Remaining: order.Quantity - order.Refunded - order.Refunding,
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &result, nil
+}
+
+// Pour takes a single drink of a product from a card at a tap, recording the pour and writing
+// it to the history of the card in a single transaction. The updated card is returned.
+func Pour(ctx context.Context, serverID uint64, productID primitive.ObjectID, tap string) (*cards.Card, error) {
+	var poured *cards.Card
+	err := database.WithTransaction(ctx, func(ctx context.Context) error {
+		// Take a beer from the card, this fails when it is empty or blocked
+		card, err := cards.Pour(ctx, serverID, productID)
+		if err != nil {
+			return err
+		}
+
+		// Record the pour
+		pour := pours.New(card.ID, productID, tap, card.Balance(productID))
+		if _, err := pours.Insert(ctx, &pour); err != nil {
+			return err
+		}
+
+		// Write the pour to the history of the card
+		entry := ledger.NewDebit(card.ID, productID, ledger.ReasonPour, 1, pour.ID.Hex())
+		if _, err := ledger.Insert(ctx, &entry); err != nil {
+			return err
+		}
+
+		poured = card
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return poured, nil
+}
+
+// RedeemVoucher uses a voucher code for a card and credits its drinks in a single transaction.
+// Every attempt is counted against the card before the code is looked up, so codes cannot be
+// guessed freely: a card that tried too many codes in a row returns cards.ErrVoucherLocked.
+func RedeemVoucher(ctx context.Context, code string, cardID primitive.ObjectID) (*vouchers.Voucher, error) {
+	// Count the attempt outside of the transaction, so a failed code cannot roll it back
+	if err := cards.ReserveVoucherAttempt(ctx, cardID); err != nil {
+		return nil, err
+	}
+
+	var voucher *vouchers.Voucher
+	err := database.WithTransaction(ctx, func(ctx context.Context) error {
+		// Use the voucher, this fails when it cannot be redeemed by the card
+		redeemed, err := vouchers.Redeem(ctx, code, cardID)
+		if err != nil {
+			return err
+		}
+
+		// Credit the drinks to the card
+		if err := cards.Credit(ctx, cardID, redeemed.ProductID, redeemed.Beers); err != nil {
+			return err
+		}
+
+		// Write the credit to the history of the card
+		entry := ledger.NewCredit(cardID, redeemed.ProductID, ledger.ReasonVoucher, redeemed.Beers, redeemed.Code)
+		if _, err := ledger.Insert(ctx, &entry); err != nil {
+			return err
+		}
+
+		voucher = redeemed
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// A redeemed code gives the card all its attempts back
+	if err := cards.ResetVoucherAttempts(ctx, cardID); err != nil {
+		return nil, err
+	}
+
+	return voucher, nil
+}
+
+// Transfer moves drinks of a product from one card to another in a single transaction. It fails with
+// cards.ErrNoBeers when the source card does not have enough of them. Both cards record the transfer
+// in their history, pointing at each other.
+func Transfer(ctx context.Context, fromID, toID, productID primitive.ObjectID, beers uint) error {
+	if fromID == toID {
+		return ErrSameCard
+	}
+
+	return database.WithTransaction(ctx, func(ctx context.Context) error {
+		// Blocked cards can neither give nor receive drinks
+		for _, cardID := range []primitive.ObjectID{fromID, toID} {
+			card, err := cards.GetByID(ctx, cardID)
+			if err != nil {
+				return err
+			}
+			if card.Blocked {
+				return cards.ErrBlocked
+			}
+		}
+
+		// Take the drinks from the source card
+		if err := cards.Debit(ctx, fromID, productID, beers); err != nil {
+			return err
+		}
+
+		// Give the drinks to the target card
+		if err := cards.Credit(ctx, toID, productID, beers); err != nil {
+			return err
+		}
+
+		// Write the transfer to the history of both cards
+		out := ledger.NewDebit(fromID, productID, ledger.ReasonTransferOut, beers, toID.Hex())
+		if _, err := ledger.Insert(ctx, &out); err != nil {
+			return err
+		}
+		in := ledger.NewCredit(toID, productID, ledger.ReasonTransferIn, beers, fromID.Hex())
+		_, err := ledger.Insert(ctx, &in)
+		return err
+	})
+}
+
+// Adjust corrects the balance of a product on a card by the owner, granting drinks for a
+// positive change and taking them for a negative one. The note explains the correction in
+// the history of the card. A card never goes below zero, which returns cards.ErrNoBeers.
+func Adjust(ctx context.Context, cardID, productID primitive.ObjectID, change int64, note string) error {
+	if change == 0 {
+		return ErrNoChange
+	}
+
+	return database.WithTransaction(ctx, func(ctx context.Context) error {
+		// Change the balance of the card
+		var entry ledger.Entry
+		if change > 0 {
+			if err := cards.Grant(ctx, cardID, productID, uint(change)); err != nil {
+				return err
+			}
+			entry = ledger.NewCredit(cardID, productID, ledger.ReasonGrant, uint(change), "")
+		} else {
+			if err := cards.Debit(ctx, cardID, productID, uint(-change)); err != nil {
+				return err
+			}
+			entry = ledger.NewDebit(cardID, productID, ledger.ReasonAdjustment, uint(-change), "")
+		}
+
+		// Write the correction to the history of the card
+		entry.Note = note
+		_, err := ledger.Insert(ctx, &entry)
+		return err
+	})
+}
+
+// Replace blocks a lost or stolen card and moves all its remaining drinks onto a replacement
+// card, which is inserted as part of the same transaction. The note explains the move in the
+// history of both cards. Replacing a card that is already blocked returns cards.ErrBlocked;
+// drinks credited to it after it was blocked are moved with MoveToReplacement instead.
+func Replace(ctx context.Context, cardID primitive.ObjectID, replacement *cards.Card, note string) error {
+	if replacement.ID.IsZero() {
+		replacement.ID = primitive.NewObjectID()
+	}
+
+	return database.WithTransaction(ctx, func(ctx context.Context) error {
+		// Block the card so nothing can be poured from it anymore
+		if err := cards.Block(ctx, cardID, replacement.ID); err != nil {
+			return err
+		}
+		card, err := cards.GetByID(ctx, cardID)
+		if err != nil {
+			return err
+		}
+
+		// Issue the replacement, which keeps the last purchase of the card it replaces
+		replacement.LastPurchase = card.LastPurchase
+		if err := cards.Insert(ctx, replacement); err != nil {
+			return err
+		}
+
+		return moveBalances(ctx, card, replacement.ID, note)
+	})
+}
+
+// MoveToReplacement moves the drinks credited to a blocked card after it was blocked, such as
+// orders that were paid late, onto the card that replaced it. The replacement is returned.
+func MoveToReplacement(ctx context.Context, cardID primitive.ObjectID, note string) (*cards.Card, error) {
+	var replacement *cards.Card
+	err := database.WithTransaction(ctx, func(ctx context.Context) error {
+		// Only blocked cards that were replaced have somewhere to move their drinks to
+		card, err := cards.GetByID(ctx, cardID)
+		if err != nil {
+			return err
+		}
+		if !card.Blocked {
+			return ErrNotBlocked
+		}
+		if card.ReplacedBy.IsZero() {
+			return ErrNoReplacement
+		}
+		if card.Total() == 0 {
+			return ErrNothingToMove
+		}
+
+		// The replacement must still be in use
+		replacement, err = cards.GetByID(ctx, card.ReplacedBy)
+		if err != nil {
+			return err
+		}
+		if replacement.Blocked {
+			return cards.ErrBlocked
+		}
+
+		return moveBalances(ctx, card, replacement.ID, note)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return replacement, nil
+}
+
+// DeleteCard deletes a card that has no drinks left and no orders waiting to be settled, which
+// would otherwise credit or refund a card that no longer exists. It fails with cards.ErrNotEmpty,
+// cards.ErrAdminCard or ErrOpenOrders when the card must be kept.
+func DeleteCard(ctx context.Context, cardID primitive.ObjectID) error {
+	return database.WithTransaction(ctx, func(ctx context.Context) error {
+		// Orders still being paid or refunded need the card
+		open, err := orders.HasOpen(ctx, cardID)
+		if err != nil {
+			return err
+		}
+		if open {
+			return ErrOpenOrders
+		}
+
+		// Delete the card, but only when its balances are zero
+		return cards.DeleteEmpty(ctx, cardID)
+	})
+}
+
+// moveBalances moves the balance of every product from a blocked card to its replacement,
+// writing the move with the note to the history of both cards
+func moveBalances(ctx context.Context, card *cards.Card, replacementID primitive.ObjectID, note string) error {
+	for product, beers := range card.Balances {
+		productID, err := primitive.ObjectIDFromHex(product)
+		if err != nil {
+			return err
+		}
+		if beers == 0 {
+			continue
+		}
+		if err := cards.Debit(ctx, card.ID, productID, beers); err != nil {
+			return err
+		}
+		if err := cards.Grant(ctx, replacementID, productID, beers); err != nil {
+			return err
+		}
+
+		// Write the move to the history of both cards
+		out := ledger.NewDebit(card.ID, productID, ledger.ReasonReplacementOut, beers, replacementID.Hex())
+		out.Note = note
+		if _, err := ledger.Insert(ctx, &out); err != nil {
+			return err
+		}
+		in := ledger.NewCredit(replacementID, productID, ledger.ReasonReplacementIn, beers, card.ID.Hex())
+		in.Note = note
+		if _, err := ledger.Insert(ctx, &in); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Expire takes every remaining drink from a card that was last active before the cutoff, writing
+// an expiry to its history for each product. Nothing expires when drinks were added to the card
+// since. The number of expired drinks is returned.
+func Expire(ctx context.Context, cardID primitive.ObjectID, cutoff time.Time, note string) (uint, error) {
+	var expired uint
+	err := database.WithTransaction(ctx, func(ctx context.Context) error {
+		expired = 0
+
+		// Drinks may have been added since the card was found dormant
+		card, err := cards.GetByID(ctx, cardID)
+		if err != nil {
+			return err
+		}
+		if !card.LastActive().Before(cutoff) {
+			return nil
+		}
+
+		// Take the balance of every product
+		for product, beers := range card.Balances {
+			productID, err := primitive.ObjectIDFromHex(product)
+			if err != nil {
+				return err
+			}
+			if beers == 0 {
+				continue
+			}
+			if err := cards.Debit(ctx, card.ID, productID, beers); err != nil {
+				return err
+			}
+
+			// Write the expiry to the history of the card
+			entry := ledger.NewDebit(card.ID, productID, ledger.ReasonExpiry, beers, "")
+			entry.Note = note
+			if _, err := ledger.Insert(ctx, &entry); err != nil {
+				return err
+			}
+			expired += beers
+		}
+
+		return nil
+	})
+	return expired, err
+}
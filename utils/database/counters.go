@@ -0,0 +1,43 @@
+package database
+
+import (
+	"context"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// counter is a document in the collection "counters" holding the last handed out value of a sequence
+type counter struct {
+	Name  string `bson:"_id"`
+	Value uint64 `bson:"value"`
+}
+
+// NextSequence atomically increments a named sequence and returns the new value,
+// so concurrent callers never receive the same number. A new sequence starts at 1.
+func NextSequence(ctx context.Context, name string) (uint64, error) {
+	// Setup the database request
+	collection := GetCollection("counters")
+	update := bson.M{"$inc": bson.M{"value": uint64(1)}}
+	findOptions := options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After)
+
+	// Increment the sequence in the collection "counters"
+	var c counter
+	if err := collection.FindOneAndUpdate(ctx, bson.M{"_id": name}, update, findOptions).Decode(&c); err != nil {
+		return 0, err
+	}
+
+	return c.Value, nil
+}
+
+// AdvanceSequence makes sure a named sequence is at least the given value, so numbers
+// handed out before the sequence existed are never handed out again.
+func AdvanceSequence(ctx context.Context, name string, value uint64) error {
+	// Setup the database request
+	collection := GetCollection("counters")
+	update := bson.M{"$max": bson.M{"value": value}}
+
+	// Raise the sequence in the collection "counters" if it is lower
+	_, err := collection.UpdateOne(ctx, bson.M{"_id": name}, update, options.Update().SetUpsert(true))
+	return err
+}
@@ -2,13 +2,18 @@ package database
 
 import (
 	"context"
+	"errors"
 	"log"
 	"sync"
 
+	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
+// ErrNoTransactions is returned when the server is a standalone MongoDB, which cannot run transactions
+var ErrNoTransactions = errors.New("MongoDB must run as a replica set or sharded cluster, a standalone server does not support transactions")
+
 var (
 	c		*mongo.Client
     db		*mongo.Database
@@ -41,13 +46,25 @@ func Connect(uri, database string) error {
         return err
     }
 
+    // Settling payments relies on transactions, so refuse a server that cannot run them
+    if err := checkTransactions(context.Background(), client); err != nil {
+        client.Disconnect(context.Background())
+        return err
+    }
+
 	// Lock the mutex to safely set the client and database
     dbLock.Lock()
-    defer dbLock.Unlock()
 
     // Set the client and database
 	c = client
     db = client.Database(database)
+    dbLock.Unlock()
+
+    // Create the indexes the models rely on, repairs use the connection that was just set
+    if err := ensureIndexes(context.Background(), client.Database(database)); err != nil {
+        Disconnect()
+        return err
+    }
 
     // Log the initialization
     log.Println("Connected to MongoDB")
@@ -55,6 +72,26 @@ func Connect(uri, database string) error {
     return nil
 }
 
+// checkTransactions asks the server what it is, only members of a replica set and the routers
+// of a sharded cluster support transactions
+func checkTransactions(ctx context.Context, client *mongo.Client) error {
+	// Run the hello command on the server
+	var hello struct {
+		SetName string `bson:"setName"`
+		Msg     string `bson:"msg"`
+	}
+	err := client.Database("admin").RunCommand(ctx, bson.D{{Key: "hello", Value: 1}}).Decode(&hello)
+	if err != nil {
+		return err
+	}
+
+	// A replica set reports its name, a router of a sharded cluster reports isdbgrid
+	if hello.SetName == "" && hello.Msg != "isdbgrid" {
+		return ErrNoTransactions
+	}
+	return nil
+}
+
 // Disconnect clears the initialized MongoDB client and closes the connection
 func Disconnect() error {
     // Check if the client is already closed
@@ -79,6 +116,28 @@ func Disconnect() error {
     return nil
 }
 
+// WithTransaction runs fn inside a MongoDB transaction, committing only when fn succeeds.
+// The transaction is retried as a whole on transient errors, so fn must be safe to repeat.
+func WithTransaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	// Lock the mutex to safely get the client
+	dbLock.Lock()
+	client := c
+	dbLock.Unlock()
+
+	// Start a session for the transaction
+	session, err := client.StartSession()
+	if err != nil {
+		return err
+	}
+	defer session.EndSession(ctx)
+
+	// Run the callback inside the transaction
+	_, err = session.WithTransaction(ctx, func(sessionCtx mongo.SessionContext) (interface{}, error) {
+		return nil, fn(sessionCtx)
+	})
+	return err
+}
+
 // Get returns a collection in the database
 func GetCollection(collection string) *mongo.Collection {
 	// Lock the mutex to safely get the database
@@ -0,0 +1,59 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+var (
+	indexes     = map[string][]mongo.IndexModel{}
+	repairs     []func(ctx context.Context) error
+	indexesLock sync.Mutex
+)
+
+// RegisterIndexes adds indexes that must exist on a collection. Models register their
+// indexes from init, and they are created every time a connection is established.
+func RegisterIndexes(collection string, models ...mongo.IndexModel) {
+	// Lock the mutex to safely add the indexes
+	indexesLock.Lock()
+	defer indexesLock.Unlock()
+
+	indexes[collection] = append(indexes[collection], models...)
+}
+
+// RegisterRepair adds a function that fixes documents which would violate a registered index,
+// such as duplicates from before the index existed. Repairs run before the indexes are created.
+func RegisterRepair(repair func(ctx context.Context) error) {
+	// Lock the mutex to safely add the repair
+	indexesLock.Lock()
+	defer indexesLock.Unlock()
+
+	repairs = append(repairs, repair)
+}
+
+// ensureIndexes runs all registered repairs and then creates all registered indexes,
+// leaving indexes that already exist untouched
+func ensureIndexes(ctx context.Context, database *mongo.Database) error {
+	// Lock the mutex to safely read the repairs and indexes
+	indexesLock.Lock()
+	defer indexesLock.Unlock()
+
+	// Fix the documents that would keep the indexes from being created
+	for _, repair := range repairs {
+		if err := repair(ctx); err != nil {
+			return fmt.Errorf("failed to repair documents before creating the indexes: %v", err)
+		}
+	}
+
+	// Create the indexes of every collection
+	for collection, models := range indexes {
+		if _, err := database.Collection(collection).Indexes().CreateMany(ctx, models); err != nil {
+			return fmt.Errorf("failed to create the indexes of %q: %v", collection, err)
+		}
+	}
+
+	return nil
+}
@@ -2,6 +2,11 @@ package cards
 
 import (
 	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"log"
+	"strings"
 	"time"
 	"website/utils/database"
 
@@ -9,14 +14,145 @@ import (
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
+	"golang.org/x/crypto/bcrypt"
 )
 
 // Card represents data for an RFID card
 type Card struct {
-	ID           primitive.ObjectID `bson:"_id,omitempty"`
-	ServerID	 uint64				`bson:"server_id"`
-	Beers        uint               `bson:"beers"`
-	LastPurchase time.Time          `bson:"last_purchase"`
+	ID           primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	ServerID	 uint64				`bson:"server_id" json:"server_id"`
+	Token        string             `bson:"token,omitempty" json:"token,omitempty"`
+	Batch        string             `bson:"batch,omitempty" json:"batch,omitempty"`
+	UID          string             `bson:"uid,omitempty" json:"uid,omitempty"`
+	Blocked      bool               `bson:"blocked,omitempty" json:"blocked"`
+	ReplacedBy   primitive.ObjectID `bson:"replaced_by,omitempty" json:"-"`
+
+	PINHash        string    `bson:"pin_hash,omitempty" json:"-"`
+	PINForPours    bool      `bson:"pin_for_pours,omitempty" json:"pin_for_pours"`
+	PINFailures    uint      `bson:"pin_failures,omitempty" json:"-"`
+	PINLockedUntil time.Time `bson:"pin_locked_until,omitempty" json:"-"`
+
+	VoucherFailures    uint      `bson:"voucher_failures,omitempty" json:"-"`
+	VoucherLockedUntil time.Time `bson:"voucher_locked_until,omitempty" json:"-"`
+	Balances     map[string]uint    `bson:"balances" json:"balances"`
+	LastPurchase time.Time          `bson:"last_purchase" json:"last_purchase"`
+	LastActivity time.Time          `bson:"last_activity,omitempty" json:"last_activity"`
+}
+
+// Filter narrows down a list of cards. Zero values do not filter.
+type Filter struct {
+	ProductID       primitive.ObjectID // Compare the balance of this product instead of the total
+	MinBalance      *uint
+	MaxBalance      *uint
+	PurchasedAfter  time.Time
+	PurchasedBefore time.Time
+}
+
+// balanceKey returns the field holding the balance of a product on a card
+func balanceKey(productID primitive.ObjectID) string {
+	return "balances." + productID.Hex()
+}
+
+// GenerateToken creates a random secret that proves possession of a card
+func GenerateToken() (string, error) {
+	secret := make([]byte, 16)
+	if _, err := rand.Read(secret); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(secret), nil
+}
+
+// LastActive returns when drinks were last added to the card, or when it was created when that never happened
+func (c *Card) LastActive() time.Time {
+	if c.LastActivity.IsZero() {
+		return c.ID.Timestamp()
+	}
+	return c.LastActivity
+}
+
+// HasPIN reports whether the customer protected the card with a PIN
+func (c *Card) HasPIN() bool {
+	return c.PINHash != ""
+}
+
+// HashPIN validates a PIN and creates a secure hash for it
+func HashPIN(pin string) (string, error) {
+	if len(pin) < 4 || len(pin) > 8 || strings.Trim(pin, "0123456789") != "" {
+		return "", ErrInvalidPIN
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(pin), bcrypt.DefaultCost)
+	if err != nil {
+		return "", err
+	}
+	return string(hash), nil
+}
+
+// Balance returns how many drinks of a product are left on the card
+func (c *Card) Balance(productID primitive.ObjectID) uint {
+	return c.Balances[productID.Hex()]
+}
+
+// Total returns how many drinks of any product are left on the card
+func (c *Card) Total() uint {
+	var total uint
+	for _, beers := range c.Balances {
+		total += beers
+	}
+	return total
+}
+
+// ErrNoBeers is returned when a card has no beers left to pour
+var ErrNoBeers = errors.New("card has no beers left")
+
+// ErrBlocked is returned when a blocked card is used
+var ErrBlocked = errors.New("card is blocked")
+
+// PIN errors, returned when checking the PIN of a card
+var (
+	ErrInvalidPIN  = errors.New("a PIN must be 4 to 8 digits")
+	ErrPINRequired = errors.New("card needs a PIN")
+	ErrWrongPIN    = errors.New("wrong PIN")
+	ErrPINLocked   = errors.New("card is locked after too many wrong PINs")
+)
+
+const (
+	// MaxPINFailures is how many wrong PINs in a row lock a card
+	MaxPINFailures = 5
+
+	// PINLockout is how long a card stays locked after too many wrong PINs
+	PINLockout = 15 * time.Minute
+)
+
+// ErrVoucherLocked is returned when a card tried too many voucher codes that could not be redeemed
+var ErrVoucherLocked = errors.New("card is locked after too many invalid voucher codes")
+
+const (
+	// MaxVoucherFailures is how many voucher codes in a row a card may fail to redeem
+	MaxVoucherFailures = 10
+
+	// VoucherLockout is how long a card may not redeem vouchers after too many failures
+	VoucherLockout = time.Hour
+)
+
+// Deletion errors, returned when a card must be kept
+var (
+	ErrAdminCard = errors.New("the admin card cannot be deleted")
+	ErrNotEmpty  = errors.New("card still has beers")
+)
+
+// ErrUIDInUse is returned when an RFID tag is bound to a card while another card already has it
+var ErrUIDInUse = errors.New("tag is already bound to another card")
+
+// NormalizeUID turns an RFID UID as reported by a reader, like "04:a2:2b:1c", into the
+// stored form "04A22B1C". An empty string is returned when the UID holds no hex digits.
+func NormalizeUID(uid string) string {
+	var normalized strings.Builder
+	for _, c := range strings.ToUpper(uid) {
+		if strings.ContainsRune("0123456789ABCDEF", c) {
+			normalized.WriteRune(c)
+		}
+	}
+	return normalized.String()
 }
 
 // findHighestQR finds the highest QR value in the "cards" collection in MongoDB
@@ -40,18 +176,113 @@ func findHighestServerID(ctx context.Context) (uint64, error) {
 	return card.ServerID, nil
 }
 
-// New creates a new Card instance with default values and a unique QR value
-func New(ctx context.Context) (Card, error) {
-	// Find the highest QR value in the database
+// serverIDSequence is the name of the counter handing out server IDs
+const serverIDSequence = "cards.server_id"
+
+func init() {
+	// Server IDs, tokens and RFID tags each identify a single card
+	database.RegisterIndexes("cards",
+		mongo.IndexModel{
+			Keys:    bson.D{{Key: "server_id", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+		mongo.IndexModel{
+			Keys:    bson.D{{Key: "token", Value: 1}},
+			Options: options.Index().SetUnique(true).SetPartialFilterExpression(bson.M{"token": bson.M{"$type": "string"}}),
+		},
+		mongo.IndexModel{
+			Keys:    bson.D{{Key: "uid", Value: 1}},
+			Options: options.Index().SetUnique(true).SetPartialFilterExpression(bson.M{"uid": bson.M{"$type": "string"}}),
+		},
+	)
+
+	// Cards from before the counter existed may share a server ID, which the index refuses
+	database.RegisterRepair(renumberDuplicateServerIDs)
+}
+
+// renumberDuplicateServerIDs gives every card that shares its server ID with an older card
+// the next free server ID, so the unique index on server IDs can be created
+func renumberDuplicateServerIDs(ctx context.Context) error {
+	// Setup the database request
+	collection := database.GetCollection("cards")
+	pipeline := mongo.Pipeline{
+		{{Key: "$sort", Value: bson.D{{Key: "_id", Value: 1}}}},
+		{{Key: "$group", Value: bson.M{"_id": "$server_id", "cards": bson.M{"$push": "$_id"}}}},
+		{{Key: "$match", Value: bson.M{"cards.1": bson.M{"$exists": true}}}},
+	}
+
+	// Find the server IDs that are used by more than one card, oldest card first
+	cursor, err := collection.Aggregate(ctx, pipeline)
+	if err != nil {
+		return err
+	}
+	var duplicates []struct {
+		ServerID uint64               `bson:"_id"`
+		Cards    []primitive.ObjectID `bson:"cards"`
+	}
+	if err := cursor.All(ctx, &duplicates); err != nil {
+		return err
+	}
+	if len(duplicates) == 0 {
+		return nil
+	}
+
+	// Make sure the new numbers come after the highest one in use
+	if err := SyncServerIDs(ctx); err != nil {
+		return err
+	}
+
+	// The oldest card keeps its server ID, the others get a new one
+	for _, duplicate := range duplicates {
+		for _, cardID := range duplicate.Cards[1:] {
+			serverID, err := database.NextSequence(ctx, serverIDSequence)
+			if err != nil {
+				return err
+			}
+			update := bson.M{"$set": bson.M{"server_id": serverID}}
+			if _, err := collection.UpdateOne(ctx, bson.M{"_id": cardID}, update); err != nil {
+				return err
+			}
+			log.Printf("[Warning] card %s shared server ID %d and was renumbered to %d\n", cardID.Hex(), duplicate.ServerID, serverID)
+		}
+	}
+
+	return nil
+}
+
+// SyncServerIDs moves the server ID counter past the highest server ID already in use,
+// so cards created before the counter existed keep their numbers to themselves
+func SyncServerIDs(ctx context.Context) error {
 	highest, err := findHighestServerID(ctx)
+	if err != nil {
+		return err
+	}
+	return database.AdvanceSequence(ctx, serverIDSequence, highest)
+}
+
+// New creates a new Card instance with default values and the next free server ID
+func New(ctx context.Context) (Card, error) {
+	// Atomically take the next server ID, so concurrent creations never share one
+	serverID, err := database.NextSequence(ctx, serverIDSequence)
+	if err != nil {
+		return Card{}, err
+	}
+
+	return NewWithServerID(serverID)
+}
+
+// NewWithServerID creates a new Card instance with default values and the given server ID
+func NewWithServerID(serverID uint64) (Card, error) {
+	// Generate the secret token of the card
+	token, err := GenerateToken()
 	if err != nil {
 		return Card{}, err
 	}
 
-	// Increment the highest QR value to generate a unique QR for the new card
 	return Card{
-		ServerID:     highest + 1,
-		Beers:        0,
+		ServerID:     serverID,
+		Token:        token,
+		Balances:     map[string]uint{},
 		LastPurchase: time.Time{},
 	}, nil
 }
@@ -73,6 +304,51 @@ func GetByServerID(ctx context.Context, ServerID uint64) (*Card, error) {
 	return &card, nil
 }
 
+// GetByToken retrieves a card document from MongoDB by its secret token
+func GetByToken(ctx context.Context, token string) (*Card, error) {
+	// Cards without a token can never be found this way
+	if token == "" {
+		return nil, mongo.ErrNoDocuments
+	}
+
+	// Setup the database request
+	collection := database.GetCollection("cards")
+	filter := bson.M{"token": token}
+
+	// Get the card from the collection "cards"
+	var card Card
+	err := collection.FindOne(ctx, filter).Decode(&card)
+	if err != nil {
+		return nil, err
+	}
+
+	// If no error was received, return the card
+	return &card, nil
+}
+
+// GetByUID retrieves a card document from MongoDB by the UID of its RFID tag
+func GetByUID(ctx context.Context, uid string) (*Card, error) {
+	// Cards without a tag can never be found this way
+	uid = NormalizeUID(uid)
+	if uid == "" {
+		return nil, mongo.ErrNoDocuments
+	}
+
+	// Setup the database request
+	collection := database.GetCollection("cards")
+	filter := bson.M{"uid": uid}
+
+	// Get the card from the collection "cards"
+	var card Card
+	err := collection.FindOne(ctx, filter).Decode(&card)
+	if err != nil {
+		return nil, err
+	}
+
+	// If no error was received, return the card
+	return &card, nil
+}
+
 // GetByID retrieves a card document from MongoDB by its ObjectID
 func GetByID(ctx context.Context, cardID primitive.ObjectID) (*Card, error) {
 	// Setup the database request
@@ -90,6 +366,145 @@ func GetByID(ctx context.Context, cardID primitive.ObjectID) (*Card, error) {
 	return &card, nil
 }
 
+// GetByBatch retrieves the cards created together in a batch, ordered by server ID
+func GetByBatch(ctx context.Context, batch string) ([]Card, error) {
+	// Setup the database request
+	collection := database.GetCollection("cards")
+	filter := bson.M{"batch": batch}
+	findOptions := options.Find().SetSort(bson.D{{Key: "server_id", Value: 1}})
+
+	// Get the cards from the collection "cards"
+	cursor, err := collection.Find(ctx, filter, findOptions)
+	if err != nil {
+		return nil, err
+	}
+
+	// Decode all cards
+	cards := []Card{}
+	if err := cursor.All(ctx, &cards); err != nil {
+		return nil, err
+	}
+
+	return cards, nil
+}
+
+// GetDormant retrieves the cards with drinks left that were last active before the given moment,
+// see LastActive
+func GetDormant(ctx context.Context, before time.Time) ([]Card, error) {
+	// Setup the database request, cards without activity count from when they were created
+	collection := database.GetCollection("cards")
+	one := uint(1)
+	filter := Filter{MinBalance: &one}.query()
+	filter["$or"] = bson.A{
+		bson.M{"last_activity": bson.M{"$lt": before}},
+		bson.M{"last_activity": bson.M{"$exists": false}, "_id": bson.M{"$lt": primitive.NewObjectIDFromTimestamp(before)}},
+	}
+
+	// Get the cards from the collection "cards"
+	cursor, err := collection.Find(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	// Decode all cards
+	cards := []Card{}
+	if err := cursor.All(ctx, &cards); err != nil {
+		return nil, err
+	}
+
+	return cards, nil
+}
+
+// GetAll retrieves every card document from MongoDB
+func GetAll(ctx context.Context) ([]Card, error) {
+	// Setup the database request
+	collection := database.GetCollection("cards")
+
+	// Get the cards from the collection "cards"
+	cursor, err := collection.Find(ctx, bson.M{})
+	if err != nil {
+		return nil, err
+	}
+
+	// Decode all cards
+	cards := []Card{}
+	if err := cursor.All(ctx, &cards); err != nil {
+		return nil, err
+	}
+
+	return cards, nil
+}
+
+// query turns a filter into a MongoDB query
+func (f Filter) query() bson.M {
+	query := bson.M{}
+
+	// Compare the balance of a single product, or the total of all products
+	var balance interface{} = bson.M{"$sum": bson.M{"$map": bson.M{
+		"input": bson.M{"$objectToArray": bson.M{"$ifNull": bson.A{"$balances", bson.M{}}}},
+		"in":    "$$this.v",
+	}}}
+	if !f.ProductID.IsZero() {
+		balance = bson.M{"$ifNull": bson.A{"$" + balanceKey(f.ProductID), 0}}
+	}
+	var conditions bson.A
+	if f.MinBalance != nil {
+		conditions = append(conditions, bson.M{"$gte": bson.A{balance, *f.MinBalance}})
+	}
+	if f.MaxBalance != nil {
+		conditions = append(conditions, bson.M{"$lte": bson.A{balance, *f.MaxBalance}})
+	}
+	if len(conditions) > 0 {
+		query["$expr"] = bson.M{"$and": conditions}
+	}
+
+	// Compare the last purchase
+	purchase := bson.M{}
+	if !f.PurchasedAfter.IsZero() {
+		purchase["$gte"] = f.PurchasedAfter
+	}
+	if !f.PurchasedBefore.IsZero() {
+		purchase["$lt"] = f.PurchasedBefore
+	}
+	if len(purchase) > 0 {
+		query["last_purchase"] = purchase
+	}
+
+	return query
+}
+
+// List retrieves a page of the cards matching a filter, ordered by server ID,
+// together with the number of matching cards on all pages
+func List(ctx context.Context, filter Filter, skip, limit int64) ([]Card, int64, error) {
+	// Setup the database request
+	collection := database.GetCollection("cards")
+	query := filter.query()
+	findOptions := options.Find().
+		SetSort(bson.D{{Key: "server_id", Value: 1}}).
+		SetSkip(skip).
+		SetLimit(limit)
+
+	// Count the matching cards in the collection "cards"
+	total, err := collection.CountDocuments(ctx, query)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	// Get the cards on the page from the collection "cards"
+	cursor, err := collection.Find(ctx, query, findOptions)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	// Decode all cards
+	cards := []Card{}
+	if err := cursor.All(ctx, &cards); err != nil {
+		return nil, 0, err
+	}
+
+	return cards, total, nil
+}
+
 // Insert adds a new card document to the "cards" collection in MongoDB for testing
 func Insert(ctx context.Context, card *Card) error {
 	// Setup the database request
@@ -100,6 +515,31 @@ func Insert(ctx context.Context, card *Card) error {
 	return err
 }
 
+// InsertMany adds new card documents to the "cards" collection in MongoDB
+func InsertMany(ctx context.Context, batch []Card) error {
+	// Setup the database request
+	collection := database.GetCollection("cards")
+	documents := make([]interface{}, len(batch))
+	for i := range batch {
+		documents[i] = batch[i]
+	}
+
+	// Insert the cards into the collection "cards"
+	result, err := collection.InsertMany(ctx, documents)
+	if err != nil {
+		return err
+	}
+
+	// Fill in the IDs of the inserted cards
+	for i, id := range result.InsertedIDs {
+		if objectID, ok := id.(primitive.ObjectID); ok {
+			batch[i].ID = objectID
+		}
+	}
+
+	return nil
+}
+
 // UpdateByID updates an existing card document in the "cards" collection in MongoDB by its ID
 func UpdateByID(ctx context.Context, cardID primitive.ObjectID, updates bson.M) error {
 	// Setup the database request
@@ -111,3 +551,418 @@ func UpdateByID(ctx context.Context, cardID primitive.ObjectID, updates bson.M)
 	_, err := collection.UpdateOne(ctx, filter, update)
 	return err
 }
+
+// BindUID binds an RFID tag to a card, replacing the tag it had before
+func BindUID(ctx context.Context, cardID primitive.ObjectID, uid string) error {
+	// Setup the database request
+	collection := database.GetCollection("cards")
+	filter := bson.M{"_id": cardID}
+	update := bson.M{"$set": bson.M{"uid": NormalizeUID(uid)}}
+
+	// Update the card in the collection "cards", the unique index refuses tags of other cards
+	result, err := collection.UpdateOne(ctx, filter, update)
+	if mongo.IsDuplicateKeyError(err) {
+		return ErrUIDInUse
+	} else if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+
+	return nil
+}
+
+// UnbindUID removes the RFID tag from a card
+func UnbindUID(ctx context.Context, cardID primitive.ObjectID) error {
+	// Setup the database request
+	collection := database.GetCollection("cards")
+	filter := bson.M{"_id": cardID}
+	update := bson.M{"$unset": bson.M{"uid": ""}}
+
+	// Update the card in the collection "cards"
+	result, err := collection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+
+	return nil
+}
+
+// SetPIN replaces the PIN of a card with a hash from HashPIN, an empty hash removes the PIN
+func SetPIN(ctx context.Context, cardID primitive.ObjectID, hash string, forPours bool) error {
+	// Setup the database request
+	collection := database.GetCollection("cards")
+	filter := bson.M{"_id": cardID}
+	update := bson.M{
+		"$set":   bson.M{"pin_hash": hash, "pin_for_pours": forPours},
+		"$unset": bson.M{"pin_failures": "", "pin_locked_until": ""},
+	}
+	if hash == "" {
+		update = bson.M{"$unset": bson.M{"pin_hash": "", "pin_for_pours": "", "pin_failures": "", "pin_locked_until": ""}}
+	}
+
+	// Update the card in the collection "cards"
+	result, err := collection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+
+	return nil
+}
+
+// CheckPIN verifies a PIN against the PIN of a card. Every wrong PIN is counted, and after
+// MaxPINFailures wrong PINs in a row the card refuses all PINs for PINLockout. A card that
+// does not exist returns mongo.ErrNoDocuments.
+func CheckPIN(ctx context.Context, card *Card, pin string) error {
+	if !card.HasPIN() {
+		return ErrPINRequired
+	}
+
+	// Reserve the attempt before the slow comparison, so parallel guesses are counted as well
+	reserved, err := pinAttempts.reserve(ctx, card.ID)
+	if err != nil {
+		return err
+	}
+	if !reserved.HasPIN() {
+		return ErrPINRequired
+	}
+
+	// A correct PIN starts counting failures from zero again
+	if bcrypt.CompareHashAndPassword([]byte(reserved.PINHash), []byte(pin)) == nil {
+		return pinAttempts.reset(ctx, card.ID)
+	}
+
+	// Lock the card once the last attempt was used up
+	if reserved.PINFailures >= MaxPINFailures {
+		return pinAttempts.lock(ctx, card.ID, time.Now())
+	}
+
+	return ErrWrongPIN
+}
+
+// ReserveVoucherAttempt counts an attempt of a card to redeem a voucher code. After
+// MaxVoucherFailures codes in a row that could not be redeemed, the card is refused all
+// attempts for VoucherLockout, which returns ErrVoucherLocked.
+func ReserveVoucherAttempt(ctx context.Context, cardID primitive.ObjectID) error {
+	_, err := voucherAttempts.reserve(ctx, cardID)
+	return err
+}
+
+// ResetVoucherAttempts starts counting the voucher attempts of a card from zero again, after
+// it redeemed a code
+func ResetVoucherAttempts(ctx context.Context, cardID primitive.ObjectID) error {
+	return voucherAttempts.reset(ctx, cardID)
+}
+
+// attempts limits how often in a row a card may fail at something, such as guessing its PIN
+type attempts struct {
+	failures    string
+	lockedUntil string
+	max         uint
+	lockout     time.Duration
+	locked      error
+}
+
+var (
+	pinAttempts     = attempts{"pin_failures", "pin_locked_until", MaxPINFailures, PINLockout, ErrPINLocked}
+	voucherAttempts = attempts{"voucher_failures", "voucher_locked_until", MaxVoucherFailures, VoucherLockout, ErrVoucherLocked}
+)
+
+// reserve counts an attempt and returns the card with the attempt counted. Only cards that are
+// not locked and have attempts left can reserve one, so parallel attempts are counted as well.
+func (a attempts) reserve(ctx context.Context, cardID primitive.ObjectID) (*Card, error) {
+	// Setup the database request
+	collection := database.GetCollection("cards")
+	now := time.Now()
+	filter := bson.M{
+		"_id":         cardID,
+		a.failures:    bson.M{"$not": bson.M{"$gte": a.max}},
+		a.lockedUntil: bson.M{"$not": bson.M{"$gt": now}},
+	}
+	update := bson.M{"$inc": bson.M{a.failures: 1}}
+	findOptions := options.FindOneAndUpdate().SetReturnDocument(options.After)
+
+	// Count the attempt in the collection "cards"
+	var reserved Card
+	err := collection.FindOneAndUpdate(ctx, filter, update, findOptions).Decode(&reserved)
+	if err == mongo.ErrNoDocuments {
+		return nil, a.lock(ctx, cardID, now)
+	} else if err != nil {
+		return nil, err
+	}
+
+	return &reserved, nil
+}
+
+// reset starts counting the attempts of a card from zero again and lifts its lockout
+func (a attempts) reset(ctx context.Context, cardID primitive.ObjectID) error {
+	// Setup the database request
+	collection := database.GetCollection("cards")
+	update := bson.M{"$unset": bson.M{a.failures: "", a.lockedUntil: ""}}
+
+	// Update the card in the collection "cards"
+	_, err := collection.UpdateOne(ctx, bson.M{"_id": cardID}, update)
+	return err
+}
+
+// lock locks a card that used up its attempts for the lockout and returns the locked error.
+// The failures start from zero again, so the card gets all its attempts back once the lockout ends.
+// A card that does not exist returns mongo.ErrNoDocuments instead.
+func (a attempts) lock(ctx context.Context, cardID primitive.ObjectID, now time.Time) error {
+	// Setup the database request
+	collection := database.GetCollection("cards")
+	filter := bson.M{
+		"_id":         cardID,
+		a.failures:    bson.M{"$gte": a.max},
+		a.lockedUntil: bson.M{"$not": bson.M{"$gt": now}},
+	}
+	update := bson.M{"$set": bson.M{a.lockedUntil: now.Add(a.lockout), a.failures: 0}}
+
+	// Lock the card, unless it is locked already
+	result, err := collection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return err
+	}
+
+	// Nothing matched when the card was locked already, or when there is no such card
+	if result.MatchedCount == 0 {
+		count, err := collection.CountDocuments(ctx, bson.M{"_id": cardID})
+		if err != nil {
+			return err
+		}
+		if count == 0 {
+			return mongo.ErrNoDocuments
+		}
+	}
+
+	return a.locked
+}
+
+// Block marks a card as lost or stolen, so it can no longer be used, and remembers the card
+// replacing it. Blocking a blocked card returns ErrBlocked.
+func Block(ctx context.Context, cardID, replacedBy primitive.ObjectID) error {
+	// Setup the database request
+	collection := database.GetCollection("cards")
+	filter := bson.M{"_id": cardID, "blocked": bson.M{"$ne": true}}
+	update := bson.M{"$set": bson.M{"blocked": true, "replaced_by": replacedBy}}
+
+	// Update the card in the collection "cards"
+	result, err := collection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		// Distinguish a blocked card from a card that does not exist
+		if _, err := GetByID(ctx, cardID); err != nil {
+			return err
+		}
+		return ErrBlocked
+	}
+
+	return nil
+}
+
+// DeleteEmpty removes a card document from the "cards" collection in MongoDB by its ID, but only
+// when every balance is zero and it is not the admin card. The balances are checked by the delete
+// itself, so drinks credited in the meantime are never lost.
+func DeleteEmpty(ctx context.Context, cardID primitive.ObjectID) error {
+	// Setup the database request, a card without balances has nothing to lose either
+	collection := database.GetCollection("cards")
+	filter := bson.M{
+		"_id":       cardID,
+		"server_id": bson.M{"$ne": 0},
+		"$expr": bson.M{"$allElementsTrue": bson.A{bson.M{"$map": bson.M{
+			"input": bson.M{"$objectToArray": bson.M{"$ifNull": bson.A{"$balances", bson.M{}}}},
+			"as":    "balance",
+			"in":    bson.M{"$eq": bson.A{"$$balance.v", 0}},
+		}}}},
+	}
+
+	// Delete the card from the collection "cards"
+	result, err := collection.DeleteOne(ctx, filter)
+	if err != nil {
+		return err
+	}
+	if result.DeletedCount > 0 {
+		return nil
+	}
+
+	// Distinguish a card that must be kept from a card that does not exist
+	card, err := GetByID(ctx, cardID)
+	if err != nil {
+		return err
+	}
+	if card.ServerID == 0 {
+		return ErrAdminCard
+	}
+	return ErrNotEmpty
+}
+
+// Pour atomically takes a single drink of a product from a card, but only when its balance
+// is positive and the card is not blocked
+func Pour(ctx context.Context, serverID uint64, productID primitive.ObjectID) (*Card, error) {
+	// Setup the database request
+	collection := database.GetCollection("cards")
+	filter := bson.M{
+		"server_id":           serverID,
+		balanceKey(productID): bson.M{"$gt": 0},
+		"blocked":             bson.M{"$ne": true},
+	}
+	update := bson.M{"$inc": bson.M{balanceKey(productID): -1}}
+	findOptions := options.FindOneAndUpdate().SetReturnDocument(options.After)
+
+	// Decrement the beers of the card in the collection "cards"
+	var card Card
+	err := collection.FindOneAndUpdate(ctx, filter, update, findOptions).Decode(&card)
+	if err == mongo.ErrNoDocuments {
+		// Distinguish an empty or blocked card from a card that does not exist
+		card, err := GetByServerID(ctx, serverID)
+		if err != nil {
+			return nil, err
+		}
+		if card.Blocked {
+			return nil, ErrBlocked
+		}
+		return nil, ErrNoBeers
+	} else if err != nil {
+		return nil, err
+	}
+
+	// If no error was received, return the updated card
+	return &card, nil
+}
+
+// Credit atomically adds drinks of a product to a card and marks it as purchased
+func Credit(ctx context.Context, cardID, productID primitive.ObjectID, beers uint) error {
+	// Setup the database request
+	collection := database.GetCollection("cards")
+	filter := bson.M{"_id": cardID}
+	now := time.Now()
+	update := bson.M{
+		"$inc": bson.M{balanceKey(productID): beers},
+		"$set": bson.M{"last_purchase": now, "last_activity": now},
+	}
+
+	// Update the card in the collection "cards"
+	result, err := collection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+
+	return nil
+}
+
+// Grant atomically adds drinks of a product to a card without counting it as a purchase.
+// The card is still marked as active, so granted drinks expire like bought ones.
+func Grant(ctx context.Context, cardID, productID primitive.ObjectID, beers uint) error {
+	// Setup the database request
+	collection := database.GetCollection("cards")
+	filter := bson.M{"_id": cardID}
+	update := bson.M{
+		"$inc": bson.M{balanceKey(productID): beers},
+		"$set": bson.M{"last_activity": time.Now()},
+	}
+
+	// Update the card in the collection "cards"
+	result, err := collection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+
+	return nil
+}
+
+// Debit atomically takes drinks of a product from a card, but only when enough of them are left
+func Debit(ctx context.Context, cardID, productID primitive.ObjectID, beers uint) error {
+	// Setup the database request
+	collection := database.GetCollection("cards")
+	filter := bson.M{"_id": cardID, balanceKey(productID): bson.M{"$gte": beers}}
+	update := bson.M{"$inc": bson.M{balanceKey(productID): -int64(beers)}}
+
+	// Update the card in the collection "cards"
+	result, err := collection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrNoBeers
+	}
+
+	return nil
+}
+
+// MigrateLastActivity marks the cards from before activity was tracked as last active at their
+// last purchase, so they do not expire counted from when they were created
+func MigrateLastActivity(ctx context.Context) error {
+	// Setup the database request
+	collection := database.GetCollection("cards")
+	filter := bson.M{"last_activity": bson.M{"$exists": false}, "last_purchase": bson.M{"$gt": time.Time{}}}
+	update := bson.A{bson.M{"$set": bson.M{"last_activity": "$last_purchase"}}}
+
+	// Update the cards in the collection "cards"
+	_, err := collection.UpdateMany(ctx, filter, update)
+	return err
+}
+
+// MigrateBeers moves the single beer counter of cards from before products existed
+// onto the balance of the given product
+func MigrateBeers(ctx context.Context, productID primitive.ObjectID) error {
+	// Setup the database request
+	collection := database.GetCollection("cards")
+	filter := bson.M{"balances": bson.M{"$exists": false}}
+	update := bson.A{
+		bson.M{"$set": bson.M{"balances": bson.M{productID.Hex(): bson.M{"$ifNull": bson.A{"$beers", 0}}}}},
+		bson.M{"$unset": "beers"},
+	}
+
+	// Update the cards in the collection "cards"
+	_, err := collection.UpdateMany(ctx, filter, update)
+	return err
+}
+
+// AssignMissingTokens gives every card created before tokens existed its own secret token
+func AssignMissingTokens(ctx context.Context) error {
+	// Setup the database request
+	collection := database.GetCollection("cards")
+	filter := bson.M{"$or": bson.A{
+		bson.M{"token": bson.M{"$exists": false}},
+		bson.M{"token": ""},
+	}}
+
+	// Get the cards without a token from the collection "cards"
+	cursor, err := collection.Find(ctx, filter)
+	if err != nil {
+		return err
+	}
+	var missing []Card
+	if err := cursor.All(ctx, &missing); err != nil {
+		return err
+	}
+
+	// Give every card a token, unless it received one in the meantime
+	for _, card := range missing {
+		token, err := GenerateToken()
+		if err != nil {
+			return err
+		}
+		update := bson.M{"$set": bson.M{"token": token}}
+		if _, err := collection.UpdateOne(ctx, bson.M{"_id": card.ID, "$or": filter["$or"]}, update); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,239 @@
+package kegs
+
+import (
+	"website/utils/database"
+
+	"context"
+	"errors"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// density is the weight of a liter of beer in kilograms, used to turn weights into volumes
+const density = 1.0
+
+// Keg represents a keg of a product on a tap. Volumes are in liters and weights in kilograms.
+// A keg stays on its tap until it is untapped, which happens when another keg is tapped there.
+// Only one keg on a tap can be tapped at a time.
+type Keg struct {
+	ID            primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	ProductID     primitive.ObjectID `bson:"product_id" json:"product_id"`
+	Tap           string             `bson:"tap" json:"tap"`
+	Volume        float64            `bson:"volume" json:"volume"`
+	TareWeight    float64            `bson:"tare_weight" json:"tare_weight"`
+	CurrentWeight float64            `bson:"current_weight" json:"current_weight"`
+	WeighedAt     time.Time          `bson:"weighed_at" json:"weighed_at"`
+	TappedAt      time.Time          `bson:"tapped_at" json:"tapped_at"`
+	Tapped        bool               `bson:"tapped,omitempty" json:"-"`
+	UntappedAt    *time.Time         `bson:"untapped_at,omitempty" json:"untapped_at,omitempty"`
+}
+
+func init() {
+	// Every tap has a single keg on it at a time
+	database.RegisterIndexes("kegs",
+		mongo.IndexModel{
+			Keys:    bson.D{{Key: "tap", Value: 1}},
+			Options: options.Index().SetUnique(true).SetPartialFilterExpression(bson.M{"tapped": true}),
+		},
+	)
+	database.RegisterRepair(markTappedKegs)
+}
+
+// markTappedKegs marks the kegs from before the tapped flag existed. When a tap has more than
+// one keg on it, only the keg tapped last stays on, so the index on tapped kegs can be created.
+func markTappedKegs(ctx context.Context) error {
+	// Setup the database request
+	collection := database.GetCollection("kegs")
+	filter := bson.M{"untapped_at": bson.M{"$exists": false}, "tapped": bson.M{"$exists": false}}
+	findOptions := options.Find().SetSort(bson.D{{Key: "tapped_at", Value: -1}})
+
+	// Find the kegs that are on a tap without being marked, last tapped first
+	cursor, err := collection.Find(ctx, filter, findOptions)
+	if err != nil {
+		return err
+	}
+	var unmarked []Keg
+	if err := cursor.All(ctx, &unmarked); err != nil {
+		return err
+	}
+
+	// Mark the last keg of every tap, unless a marked keg is on it already, and untap the rest
+	now := time.Now()
+	for _, keg := range unmarked {
+		count, err := collection.CountDocuments(ctx, bson.M{"tap": keg.Tap, "tapped": true})
+		if err != nil {
+			return err
+		}
+		update := bson.M{"$set": bson.M{"tapped": true}}
+		if count > 0 {
+			update = bson.M{"$set": bson.M{"untapped_at": now}}
+		}
+		if _, err := collection.UpdateOne(ctx, bson.M{"_id": keg.ID}, update); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// New creates a new Keg instance tapped now. A full keg weighs its tare plus its contents.
+func New(productID primitive.ObjectID, tap string, volume, tareWeight float64) Keg {
+	now := time.Now()
+	return Keg{
+		ProductID:     productID,
+		Tap:           tap,
+		Volume:        volume,
+		TareWeight:    tareWeight,
+		CurrentWeight: tareWeight + volume*density,
+		WeighedAt:     now,
+		TappedAt:      now,
+		Tapped:        true,
+	}
+}
+
+// Remaining returns how many liters are left in the keg according to its last weight
+func (k *Keg) Remaining() float64 {
+	remaining := (k.CurrentWeight - k.TareWeight) / density
+	if remaining < 0 {
+		return 0
+	}
+	if remaining > k.Volume {
+		return k.Volume
+	}
+	return remaining
+}
+
+// Level returns how full the keg is as a percentage
+func (k *Keg) Level() float64 {
+	if k.Volume <= 0 {
+		return 0
+	}
+	return k.Remaining() / k.Volume * 100
+}
+
+// find retrieves the keg documents matching a filter, ordered by tap
+func find(ctx context.Context, filter bson.M) ([]Keg, error) {
+	// Setup the database request
+	collection := database.GetCollection("kegs")
+	findOptions := options.Find().SetSort(bson.D{{Key: "tap", Value: 1}, {Key: "tapped_at", Value: -1}})
+
+	// Get the kegs from the collection "kegs"
+	cursor, err := collection.Find(ctx, filter, findOptions)
+	if err != nil {
+		return nil, err
+	}
+
+	// Decode all kegs
+	found := []Keg{}
+	if err := cursor.All(ctx, &found); err != nil {
+		return nil, err
+	}
+
+	return found, nil
+}
+
+// GetAll retrieves every keg document from MongoDB
+func GetAll(ctx context.Context) ([]Keg, error) {
+	return find(ctx, bson.M{})
+}
+
+// GetTapped retrieves the kegs that are currently on a tap
+func GetTapped(ctx context.Context) ([]Keg, error) {
+	return find(ctx, bson.M{"tapped": true})
+}
+
+// GetByID retrieves a keg document from MongoDB by its ObjectID
+func GetByID(ctx context.Context, kegID primitive.ObjectID) (*Keg, error) {
+	// Setup the database request
+	collection := database.GetCollection("kegs")
+	filter := bson.M{"_id": kegID}
+
+	// Get the keg from the collection "kegs"
+	var keg Keg
+	err := collection.FindOne(ctx, filter).Decode(&keg)
+	if err != nil {
+		return nil, err
+	}
+
+	// If no error was received, return the keg
+	return &keg, nil
+}
+
+// Insert adds a new keg document to the "kegs" collection in MongoDB
+func Insert(ctx context.Context, keg *Keg) (*Keg, error) {
+	// Setup the database request
+	collection := database.GetCollection("kegs")
+
+	// Insert the keg into the collection "kegs"
+	insertOneResult, err := collection.InsertOne(ctx, keg)
+	if err != nil {
+		return nil, err
+	}
+
+	// Assert the InsertedID as a primitive.ObjectID
+	id, ok := insertOneResult.InsertedID.(primitive.ObjectID)
+	if !ok {
+		return nil, errors.New("Failed to assert InsertedID as primitive.ObjectID")
+	}
+
+	// If the assertion succeeds, return the inserted keg
+	keg.ID = id
+	return keg, nil
+}
+
+// Untap takes every keg off a tap, except the given keg. A keg can only be tapped once the
+// previous keg on its tap was untapped.
+func Untap(ctx context.Context, tap string, except primitive.ObjectID) error {
+	// Setup the database request
+	collection := database.GetCollection("kegs")
+	filter := bson.M{"tap": tap, "_id": bson.M{"$ne": except}, "tapped": true}
+	update := bson.M{"$set": bson.M{"untapped_at": time.Now()}, "$unset": bson.M{"tapped": ""}}
+
+	// Update the kegs in the collection "kegs"
+	_, err := collection.UpdateMany(ctx, filter, update)
+	return err
+}
+
+// UntapByID takes a keg off its tap
+func UntapByID(ctx context.Context, kegID primitive.ObjectID) error {
+	// Setup the database request
+	collection := database.GetCollection("kegs")
+	filter := bson.M{"_id": kegID, "tapped": true}
+	update := bson.M{"$set": bson.M{"untapped_at": time.Now()}, "$unset": bson.M{"tapped": ""}}
+
+	// Update the keg in the collection "kegs"
+	result, err := collection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+
+	return nil
+}
+
+// UpdateWeight stores a weight reading for the keg currently on a tap and returns the updated keg
+func UpdateWeight(ctx context.Context, tap string, weight float64, at time.Time) (*Keg, error) {
+	// Setup the database request
+	collection := database.GetCollection("kegs")
+	filter := bson.M{"tap": tap, "tapped": true}
+	update := bson.M{"$set": bson.M{"current_weight": weight, "weighed_at": at}}
+	findOptions := options.FindOneAndUpdate().
+		SetSort(bson.D{{Key: "tapped_at", Value: -1}}).
+		SetReturnDocument(options.After)
+
+	// Update the keg in the collection "kegs"
+	var keg Keg
+	err := collection.FindOneAndUpdate(ctx, filter, update, findOptions).Decode(&keg)
+	if err != nil {
+		return nil, err
+	}
+
+	// If no error was received, return the updated keg
+	return &keg, nil
+}
@@ -0,0 +1,198 @@
+package ledger
+
+import (
+	"website/utils/database"
+
+	"context"
+	"errors"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Reason describes why beers were added to or taken from a card
+type Reason string
+
+const (
+	ReasonOpening Reason = "opening" // Credit: balance that existed before the ledger
+	ReasonOrder   Reason = "order"   // Credit: paid order
+	ReasonGrant   Reason = "grant"   // Credit: granted by the owner, see the note
+	ReasonVoucher Reason = "voucher" // Credit: redeemed voucher
+	ReasonPour    Reason = "pour"    // Debit: beer poured at the tap
+	ReasonRefund  Reason = "refund"  // Debit: refunded order
+
+	ReasonTransferIn  Reason = "transfer_in"  // Credit: received from another card
+	ReasonTransferOut Reason = "transfer_out" // Debit: given to another card
+
+	ReasonAdjustment Reason = "adjustment" // Debit: taken off by the owner, see the note
+
+	ReasonReplacementIn  Reason = "replacement_in"  // Credit: moved from a blocked card this card replaces
+	ReasonReplacementOut Reason = "replacement_out" // Debit: moved to the card replacing this blocked card
+
+	ReasonExpiry Reason = "expiry" // Debit: expired after the card was not bought onto for too long
+)
+
+// Entry represents a single credit or debit of beers on a card
+type Entry struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	CardID    primitive.ObjectID `bson:"card_id" json:"card_id"`
+	ProductID primitive.ObjectID `bson:"product_id" json:"product_id"`
+	Reason    Reason             `bson:"reason" json:"reason"`
+	Beers     int64              `bson:"beers" json:"beers"`
+	Reference string             `bson:"reference" json:"reference"`
+	Note      string             `bson:"note,omitempty" json:"note,omitempty"`
+	CreatedAt time.Time          `bson:"created_at" json:"created_at"`
+}
+
+// NewCredit creates a new Entry adding drinks of a product to a card
+func NewCredit(cardID, productID primitive.ObjectID, reason Reason, beers uint, reference string) Entry {
+	return Entry{
+		CardID:    cardID,
+		ProductID: productID,
+		Reason:    reason,
+		Beers:     int64(beers),
+		Reference: reference,
+		CreatedAt: time.Now(),
+	}
+}
+
+// NewDebit creates a new Entry taking drinks of a product from a card
+func NewDebit(cardID, productID primitive.ObjectID, reason Reason, beers uint, reference string) Entry {
+	return Entry{
+		CardID:    cardID,
+		ProductID: productID,
+		Reason:    reason,
+		Beers:     -int64(beers),
+		Reference: reference,
+		CreatedAt: time.Now(),
+	}
+}
+
+// Insert adds a new entry document to the "ledger" collection in MongoDB
+func Insert(ctx context.Context, entry *Entry) (*Entry, error) {
+	// Setup the database request
+	collection := database.GetCollection("ledger")
+
+	// Insert the entry into the collection "ledger"
+	insertOneResult, err := collection.InsertOne(ctx, entry)
+	if err != nil {
+		return nil, err
+	}
+
+	// Assert the InsertedID as a primitive.ObjectID
+	id, ok := insertOneResult.InsertedID.(primitive.ObjectID)
+	if !ok {
+		return nil, errors.New("Failed to assert InsertedID as primitive.ObjectID")
+	}
+
+	// If the assertion succeeds, return the inserted entry
+	entry.ID = id
+	return entry, nil
+}
+
+// GetByCardID retrieves the history of a card from MongoDB, oldest entry first
+func GetByCardID(ctx context.Context, cardID primitive.ObjectID) ([]Entry, error) {
+	// Setup the database request
+	collection := database.GetCollection("ledger")
+	filter := bson.M{"card_id": cardID}
+	findOptions := options.Find().SetSort(bson.D{{Key: "created_at", Value: 1}})
+
+	// Get the entries from the collection "ledger"
+	cursor, err := collection.Find(ctx, filter, findOptions)
+	if err != nil {
+		return nil, err
+	}
+
+	// Decode all entries
+	entries := []Entry{}
+	if err := cursor.All(ctx, &entries); err != nil {
+		return nil, err
+	}
+
+	return entries, nil
+}
+
+// Count returns the number of entries in the history of a card
+func Count(ctx context.Context, cardID primitive.ObjectID) (int64, error) {
+	// Setup the database request
+	collection := database.GetCollection("ledger")
+	filter := bson.M{"card_id": cardID}
+
+	// Count the entries in the collection "ledger"
+	return collection.CountDocuments(ctx, filter)
+}
+
+// SumByReference adds up the beers of all entries with a reason that point to the same reference
+func SumByReference(ctx context.Context, reason Reason, reference string) (int64, error) {
+	// Setup the database request
+	collection := database.GetCollection("ledger")
+	pipeline := bson.A{
+		bson.M{"$match": bson.M{"reason": reason, "reference": reference}},
+		bson.M{"$group": bson.M{"_id": nil, "beers": bson.M{"$sum": "$beers"}}},
+	}
+
+	// Sum the entries in the collection "ledger"
+	cursor, err := collection.Aggregate(ctx, pipeline)
+	if err != nil {
+		return 0, err
+	}
+
+	// Nothing was booked when there are no entries
+	var results []struct {
+		Beers int64 `bson:"beers"`
+	}
+	if err := cursor.All(ctx, &results); err != nil {
+		return 0, err
+	}
+	if len(results) == 0 {
+		return 0, nil
+	}
+
+	return results[0].Beers, nil
+}
+
+// Balances derives the balance of every product on a card by summing its history
+func Balances(ctx context.Context, cardID primitive.ObjectID) (map[string]int64, error) {
+	// Setup the database request
+	collection := database.GetCollection("ledger")
+	pipeline := bson.A{
+		bson.M{"$match": bson.M{"card_id": cardID}},
+		bson.M{"$group": bson.M{"_id": "$product_id", "balance": bson.M{"$sum": "$beers"}}},
+	}
+
+	// Sum the entries in the collection "ledger" per product
+	cursor, err := collection.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+
+	var results []struct {
+		ProductID primitive.ObjectID `bson:"_id"`
+		Balance   int64              `bson:"balance"`
+	}
+	if err := cursor.All(ctx, &results); err != nil {
+		return nil, err
+	}
+
+	// A card without any history has no balances
+	balances := map[string]int64{}
+	for _, result := range results {
+		balances[result.ProductID.Hex()] = result.Balance
+	}
+
+	return balances, nil
+}
+
+// MigrateProduct assigns entries written before products existed to the given product
+func MigrateProduct(ctx context.Context, productID primitive.ObjectID) error {
+	// Setup the database request
+	collection := database.GetCollection("ledger")
+	filter := bson.M{"product_id": bson.M{"$exists": false}}
+	update := bson.M{"$set": bson.M{"product_id": productID}}
+
+	// Update the entries in the collection "ledger"
+	_, err := collection.UpdateMany(ctx, filter, update)
+	return err
+}
@@ -2,34 +2,110 @@ package orders
 
 import (
     "website/utils/database"
+    "website/utils/money"
 
     "context"
+    "fmt"
     "time"
-    "math"
     "errors"
+    "strings"
 
     "go.mongodb.org/mongo-driver/bson"
     "go.mongodb.org/mongo-driver/bson/primitive"
+    "go.mongodb.org/mongo-driver/mongo/options"
 )
 
+// Status represents the stage of an order in the payment process
+type Status string
+
+const (
+    StatusPending   Status = "Pending"
+    StatusPaid      Status = "Paid"
+    StatusFailed    Status = "Failed"
+    StatusCancelled Status = "Cancelled"
+    StatusExpired   Status = "Expired"
+    StatusRefunding Status = "Refunding"
+    StatusRefunded  Status = "Refunded"
+)
+
+// transitions lists the statuses every status is allowed to move to
+var transitions = map[Status][]Status{
+    StatusPending: {StatusPaid, StatusFailed, StatusCancelled, StatusExpired},
+    StatusPaid:      {StatusRefunding},
+    StatusRefunding: {StatusPaid, StatusRefunded},
+}
+
+var (
+    // ErrAlreadyProcessed is returned when an order is no longer in the expected status
+    ErrAlreadyProcessed = errors.New("order was already processed")
+
+    // ErrInvalidTransition is returned when an order may not move between two statuses
+    ErrInvalidTransition = errors.New("invalid order status transition")
+)
+
+// ParseStatus converts a status received from outside, such as a payment webhook, into a Status
+func ParseStatus(value string) (Status, error) {
+    switch strings.ToLower(strings.TrimSpace(value)) {
+    case "pending", "open":
+        return StatusPending, nil
+    case "paid":
+        return StatusPaid, nil
+    case "failed":
+        return StatusFailed, nil
+    case "cancelled", "canceled":
+        return StatusCancelled, nil
+    case "expired":
+        return StatusExpired, nil
+    case "refunded":
+        return StatusRefunded, nil
+    default:
+        return "", fmt.Errorf("unknown order status %q", value)
+    }
+}
+
+// CanTransitionTo reports whether an order with this status may move to the given status
+func (s Status) CanTransitionTo(to Status) bool {
+    for _, allowed := range transitions[s] {
+        if allowed == to {
+            return true
+        }
+    }
+    return false
+}
+
 // Order represents an order for beer on a card
 type Order struct {
-    ID          primitive.ObjectID `bson:"_id,omitempty"`
-    CardID      primitive.ObjectID `bson:"card_id"`
-    OrderDate   time.Time          `bson:"order_date"`
-    Status      string             `bson:"status"`
-    Quantity    uint               `bson:"quantity"`
-    TotalAmount float64            `bson:"total_amount"`
+    ID             primitive.ObjectID `bson:"_id,omitempty"`
+    CardID         primitive.ObjectID `bson:"card_id"`
+    ProductID      primitive.ObjectID `bson:"product_id"`
+    OrderDate      time.Time          `bson:"order_date"`
+    Status         Status             `bson:"status"`
+    Quantity       uint               `bson:"quantity"`
+    UnitPrice      money.Money        `bson:"unit_price,omitempty"`
+    TotalAmount    money.Money        `bson:"total_amount"`
+    PricingRule    string             `bson:"pricing_rule,omitempty"`
+    PaymentID      string             `bson:"payment_id"`
+    Refunded       uint               `bson:"refunded,omitempty"`
+    RefundedAmount money.Money        `bson:"refunded_amount,omitempty"`
+
+    // The refund that was claimed but not yet finished, set while the order is Refunding
+    Refunding       uint        `bson:"refunding,omitempty"`
+    RefundingAmount money.Money `bson:"refunding_amount,omitempty"`
+    RefundKey       string      `bson:"refund_key,omitempty"`
 }
 
-// New creates a new Order instance with default values
-func New(cardID primitive.ObjectID, quantity uint, price float64) Order {
+// New creates a new Order instance with default values. The total is the listed unit price times
+// the quantity, unless a pricing rule was applied, whose name is then stored with the order.
+func New(cardID, productID primitive.ObjectID, quantity uint, unitPrice, total money.Money, rule string) Order {
     return Order{
         CardID:      cardID,
+        ProductID:   productID,
         OrderDate:   time.Now(),
-        Status:      "Pending",
+        Status:      StatusPending,
         Quantity:    quantity,
-        TotalAmount: math.Round(float64(quantity) * price*100)/100,
+        UnitPrice:   unitPrice,
+        TotalAmount: total,
+        PricingRule: rule,
     }
 }
 
@@ -50,6 +126,68 @@ func GetByID(ctx context.Context, orderID primitive.ObjectID) (*Order, error) {
     return &order, nil
 }
 
+// GetPendingBefore retrieves the pending orders placed before a point in time, oldest first
+func GetPendingBefore(ctx context.Context, before time.Time) ([]Order, error) {
+    // Setup the database request
+    collection := database.GetCollection("orders")
+    filter := bson.M{"status": StatusPending, "order_date": bson.M{"$lt": before}}
+    findOptions := options.Find().SetSort(bson.D{{Key: "order_date", Value: 1}})
+
+    // Get the orders from the collection "orders"
+    cursor, err := collection.Find(ctx, filter, findOptions)
+    if err != nil {
+        return nil, err
+    }
+
+    // Decode all orders
+    pending := []Order{}
+    if err := cursor.All(ctx, &pending); err != nil {
+        return nil, err
+    }
+
+    return pending, nil
+}
+
+// GetBetween retrieves the orders placed within a period of time, oldest first
+func GetBetween(ctx context.Context, from, to time.Time) ([]Order, error) {
+    // Setup the database request
+    collection := database.GetCollection("orders")
+    filter := bson.M{"order_date": bson.M{"$gte": from, "$lt": to}}
+    findOptions := options.Find().SetSort(bson.D{{Key: "order_date", Value: 1}})
+
+    // Get the orders from the collection "orders"
+    cursor, err := collection.Find(ctx, filter, findOptions)
+    if err != nil {
+        return nil, err
+    }
+
+    // Decode all orders
+    found := []Order{}
+    if err := cursor.All(ctx, &found); err != nil {
+        return nil, err
+    }
+
+    return found, nil
+}
+
+// HasOpen reports whether a card has orders that are waiting for a payment or a refund
+func HasOpen(ctx context.Context, cardID primitive.ObjectID) (bool, error) {
+    // Setup the database request
+    collection := database.GetCollection("orders")
+    filter := bson.M{
+        "card_id": cardID,
+        "status":  bson.M{"$in": []Status{StatusPending, StatusRefunding}},
+    }
+
+    // Count the orders in the collection "orders"
+    count, err := collection.CountDocuments(ctx, filter)
+    if err != nil {
+        return false, err
+    }
+
+    return count > 0, nil
+}
+
 // Insert adds a new order document to the "orders" collection in MongoDB
 func Insert(ctx context.Context, order *Order) (*Order, error) {
     // Setup the database request
@@ -72,14 +210,140 @@ func Insert(ctx context.Context, order *Order) (*Order, error) {
     return order, nil
 }
 
-// UpdateStatus updates the status of an existing order document in the "orders" collection in MongoDB
-func UpdateStatus(ctx context.Context, orderID primitive.ObjectID, newStatus string) error {
+// SetPaymentID stores the ID the payment provider uses for an existing order
+func SetPaymentID(ctx context.Context, orderID primitive.ObjectID, paymentID string) error {
     // Setup the database request
     collection := database.GetCollection("orders")
     filter := bson.M{"_id": orderID}
-    update := bson.M{"$set": bson.M{"status": newStatus}}
+    update := bson.M{"$set": bson.M{"payment_id": paymentID}}
 
-    // Update the order with the new status
+    // Update the order with the payment ID
     _, err := collection.UpdateOne(ctx, filter, update)
     return err
 }
+
+// Transition changes the status of an order, but only if it still has the expected status
+// and the state machine allows the move
+func Transition(ctx context.Context, orderID primitive.ObjectID, from, to Status) error {
+    // Check the move against the state machine
+    if !from.CanTransitionTo(to) {
+        return ErrInvalidTransition
+    }
+
+    // Setup the database request
+    collection := database.GetCollection("orders")
+    filter := bson.M{"_id": orderID, "status": from}
+    update := bson.M{"$set": bson.M{"status": to}}
+
+    // Update the order only when nobody else changed it first
+    result, err := collection.UpdateOne(ctx, filter, update)
+    if err != nil {
+        return err
+    }
+    if result.MatchedCount == 0 {
+        return ErrAlreadyProcessed
+    }
+
+    return nil
+}
+
+// ClaimRefund moves a paid order to Refunding and records the refund that is about to be made,
+// so no other refund of the order can start until it is finished or released
+func ClaimRefund(ctx context.Context, orderID primitive.ObjectID, beers uint, amount money.Money, key string) error {
+    // Setup the database request
+    collection := database.GetCollection("orders")
+    filter := bson.M{"_id": orderID, "status": StatusPaid}
+    update := bson.M{"$set": bson.M{
+        "status":           StatusRefunding,
+        "refunding":        beers,
+        "refunding_amount": amount,
+        "refund_key":       key,
+    }}
+
+    // Update the order only when it is still paid
+    result, err := collection.UpdateOne(ctx, filter, update)
+    if err != nil {
+        return err
+    }
+    if result.MatchedCount == 0 {
+        return ErrAlreadyProcessed
+    }
+
+    return nil
+}
+
+// ReleaseRefund moves an order back to Paid when its claimed refund was not made
+func ReleaseRefund(ctx context.Context, orderID primitive.ObjectID, key string) error {
+    // Setup the database request
+    collection := database.GetCollection("orders")
+    filter := bson.M{"_id": orderID, "status": StatusRefunding, "refund_key": key}
+    update := bson.M{
+        "$set":   bson.M{"status": StatusPaid},
+        "$unset": bson.M{"refunding": "", "refunding_amount": "", "refund_key": ""},
+    }
+
+    // Update the order only when the refund is still claimed
+    result, err := collection.UpdateOne(ctx, filter, update)
+    if err != nil {
+        return err
+    }
+    if result.MatchedCount == 0 {
+        return ErrAlreadyProcessed
+    }
+
+    return nil
+}
+
+// FinishRefund adds the claimed refund of a Refunding order to what was refunded before. The order
+// becomes Refunded once all its beers were refunded, and Paid again while some are left.
+func FinishRefund(ctx context.Context, order *Order) error {
+    // Add the claimed refund to the earlier ones
+    refunded := order.Refunded + order.Refunding
+    refundedAmount := order.RefundingAmount
+    if !order.RefundedAmount.IsZero() {
+        sum, err := order.RefundedAmount.Add(order.RefundingAmount)
+        if err != nil {
+            return err
+        }
+        refundedAmount = sum
+    }
+    status := StatusPaid
+    if refunded >= order.Quantity {
+        status = StatusRefunded
+    }
+
+    // Setup the database request
+    collection := database.GetCollection("orders")
+    filter := bson.M{"_id": order.ID, "status": StatusRefunding, "refund_key": order.RefundKey}
+    update := bson.M{
+        "$set": bson.M{
+            "status":          status,
+            "refunded":        refunded,
+            "refunded_amount": refundedAmount,
+        },
+        "$unset": bson.M{"refunding": "", "refunding_amount": "", "refund_key": ""},
+    }
+
+    // Update the order only when this refund is still claimed
+    result, err := collection.UpdateOne(ctx, filter, update)
+    if err != nil {
+        return err
+    }
+    if result.MatchedCount == 0 {
+        return ErrAlreadyProcessed
+    }
+
+    return nil
+}
+
+// MigrateProduct assigns orders placed before products existed to the given product
+func MigrateProduct(ctx context.Context, productID primitive.ObjectID) error {
+    // Setup the database request
+    collection := database.GetCollection("orders")
+    filter := bson.M{"product_id": bson.M{"$exists": false}}
+    update := bson.M{"$set": bson.M{"product_id": productID}}
+
+    // Update the orders in the collection "orders"
+    _, err := collection.UpdateMany(ctx, filter, update)
+    return err
+}
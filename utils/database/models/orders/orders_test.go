@@ -0,0 +1,66 @@
+package orders
+
+import "testing"
+
+func TestParseStatus(t *testing.T) {
+    tests := []struct {
+        value   string
+        want    Status
+        wantErr bool
+    }{
+        {"paid", StatusPaid, false},
+        {"Paid", StatusPaid, false},
+        {" open ", StatusPending, false},
+        {"pending", StatusPending, false},
+        {"failed", StatusFailed, false},
+        {"canceled", StatusCancelled, false},
+        {"cancelled", StatusCancelled, false},
+        {"expired", StatusExpired, false},
+        {"refunded", StatusRefunded, false},
+        {"", "", true},
+        {"authorized", "", true},
+    }
+
+    for _, test := range tests {
+        got, err := ParseStatus(test.value)
+        if (err != nil) != test.wantErr {
+            t.Errorf("ParseStatus(%q) error = %v, want error %v", test.value, err, test.wantErr)
+            continue
+        }
+        if got != test.want {
+            t.Errorf("ParseStatus(%q) = %q, want %q", test.value, got, test.want)
+        }
+    }
+}
+
+func TestCanTransitionTo(t *testing.T) {
+    tests := []struct {
+        from, to Status
+        want     bool
+    }{
+        {StatusPending, StatusPaid, true},
+        {StatusPending, StatusFailed, true},
+        {StatusPending, StatusCancelled, true},
+        {StatusPending, StatusExpired, true},
+        {StatusPending, StatusRefunded, false},
+        {StatusPending, StatusPending, false},
+        {StatusPaid, StatusRefunding, true},
+        {StatusPaid, StatusRefunded, false},
+        {StatusPaid, StatusPending, false},
+        {StatusRefunding, StatusRefunded, true},
+        {StatusRefunding, StatusPaid, true},
+        {StatusRefunding, StatusPending, false},
+        {StatusPaid, StatusFailed, false},
+        {StatusFailed, StatusPaid, false},
+        {StatusCancelled, StatusPaid, false},
+        {StatusExpired, StatusPaid, false},
+        {StatusRefunded, StatusPaid, false},
+        {StatusRefunded, StatusRefunding, false},
+    }
+
+    for _, test := range tests {
+        if got := test.from.CanTransitionTo(test.to); got != test.want {
+            t.Errorf("%s.CanTransitionTo(%s) = %v, want %v", test.from, test.to, got, test.want)
+        }
+    }
+}
@@ -0,0 +1,54 @@
+package pours
+
+import (
+	"website/utils/database"
+
+	"context"
+	"errors"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Pour represents a single beer taken from a card at a tap
+type Pour struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty"`
+	CardID    primitive.ObjectID `bson:"card_id"`
+	ProductID primitive.ObjectID `bson:"product_id"`
+	Tap       string             `bson:"tap"`
+	PouredAt  time.Time          `bson:"poured_at"`
+	Remaining uint               `bson:"remaining"`
+}
+
+// New creates a new Pour instance for the current time
+func New(cardID, productID primitive.ObjectID, tap string, remaining uint) Pour {
+	return Pour{
+		CardID:    cardID,
+		ProductID: productID,
+		Tap:       tap,
+		PouredAt:  time.Now(),
+		Remaining: remaining,
+	}
+}
+
+// Insert adds a new pour document to the "pours" collection in MongoDB
+func Insert(ctx context.Context, pour *Pour) (*Pour, error) {
+	// Setup the database request
+	collection := database.GetCollection("pours")
+
+	// Insert the pour into the collection "pours"
+	insertOneResult, err := collection.InsertOne(ctx, pour)
+	if err != nil {
+		return nil, err
+	}
+
+	// Assert the InsertedID as a primitive.ObjectID
+	id, ok := insertOneResult.InsertedID.(primitive.ObjectID)
+	if !ok {
+		return nil, errors.New("Failed to assert InsertedID as primitive.ObjectID")
+	}
+
+	// If the assertion succeeds, return the inserted pour
+	pour.ID = id
+	return pour, nil
+}
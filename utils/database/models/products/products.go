@@ -0,0 +1,152 @@
+package products
+
+import (
+	"website/utils/database"
+	"website/utils/money"
+
+	"context"
+	"errors"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Product represents a drink that can be bought onto a card and poured at a tap
+type Product struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	Name      string             `bson:"name" json:"name"`
+	Price     money.Money        `bson:"price" json:"price"`
+	Tap       string             `bson:"tap" json:"tap"`
+	Active    bool               `bson:"active" json:"active"`
+	CreatedAt time.Time          `bson:"created_at" json:"created_at"`
+}
+
+// New creates a new active Product instance
+func New(name string, price money.Money, tap string) Product {
+	return Product{
+		Name:      name,
+		Price:     price,
+		Tap:       tap,
+		Active:    true,
+		CreatedAt: time.Now(),
+	}
+}
+
+// find retrieves the product documents matching a filter, oldest first
+func find(ctx context.Context, filter bson.M) ([]Product, error) {
+	// Setup the database request
+	collection := database.GetCollection("products")
+	findOptions := options.Find().SetSort(bson.D{{Key: "created_at", Value: 1}})
+
+	// Get the products from the collection "products"
+	cursor, err := collection.Find(ctx, filter, findOptions)
+	if err != nil {
+		return nil, err
+	}
+
+	// Decode all products
+	found := []Product{}
+	if err := cursor.All(ctx, &found); err != nil {
+		return nil, err
+	}
+
+	return found, nil
+}
+
+// GetAll retrieves every product document from MongoDB
+func GetAll(ctx context.Context) ([]Product, error) {
+	return find(ctx, bson.M{})
+}
+
+// GetActive retrieves the products that are currently for sale
+func GetActive(ctx context.Context) ([]Product, error) {
+	return find(ctx, bson.M{"active": true})
+}
+
+// GetByID retrieves a product document from MongoDB by its ObjectID
+func GetByID(ctx context.Context, productID primitive.ObjectID) (*Product, error) {
+	// Setup the database request
+	collection := database.GetCollection("products")
+	filter := bson.M{"_id": productID}
+
+	// Get the product from the collection "products"
+	var product Product
+	err := collection.FindOne(ctx, filter).Decode(&product)
+	if err != nil {
+		return nil, err
+	}
+
+	// If no error was received, return the product
+	return &product, nil
+}
+
+// GetByTap retrieves the active product that is assigned to a tap. No tap is not a tap,
+// so products without one are never returned.
+func GetByTap(ctx context.Context, tap string) (*Product, error) {
+	if tap == "" {
+		return nil, mongo.ErrNoDocuments
+	}
+
+	// Setup the database request
+	collection := database.GetCollection("products")
+	filter := bson.M{"tap": tap, "active": true}
+
+	// Get the product from the collection "products"
+	var product Product
+	err := collection.FindOne(ctx, filter).Decode(&product)
+	if err != nil {
+		return nil, err
+	}
+
+	// If no error was received, return the product
+	return &product, nil
+}
+
+// Insert adds a new product document to the "products" collection in MongoDB
+func Insert(ctx context.Context, product *Product) (*Product, error) {
+	// Setup the database request
+	collection := database.GetCollection("products")
+
+	// Insert the product into the collection "products"
+	insertOneResult, err := collection.InsertOne(ctx, product)
+	if err != nil {
+		return nil, err
+	}
+
+	// Assert the InsertedID as a primitive.ObjectID
+	id, ok := insertOneResult.InsertedID.(primitive.ObjectID)
+	if !ok {
+		return nil, errors.New("Failed to assert InsertedID as primitive.ObjectID")
+	}
+
+	// If the assertion succeeds, return the inserted product
+	product.ID = id
+	return product, nil
+}
+
+// UpdateByID updates an existing product document in the "products" collection in MongoDB by its ID
+func UpdateByID(ctx context.Context, productID primitive.ObjectID, updates bson.M) error {
+	// Setup the database request
+	collection := database.GetCollection("products")
+	filter := bson.M{"_id": productID}
+	update := bson.M{"$set": updates}
+
+	// Update the product in the collection "products"
+	_, err := collection.UpdateOne(ctx, filter, update)
+	return err
+}
+
+// ReleaseTap removes a tap from every product except the given one, so a tap serves a single product
+func ReleaseTap(ctx context.Context, tap string, except primitive.ObjectID) error {
+	// Setup the database request
+	collection := database.GetCollection("products")
+	filter := bson.M{"tap": tap, "_id": bson.M{"$ne": except}}
+	update := bson.M{"$set": bson.M{"tap": ""}}
+
+	// Update the products in the collection "products"
+	_, err := collection.UpdateMany(ctx, filter, update)
+	return err
+}
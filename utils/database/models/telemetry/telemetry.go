@@ -0,0 +1,122 @@
+package telemetry
+
+import (
+	"website/utils/database"
+
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	// BucketSize is the period of weight readings combined into a single bucket
+	BucketSize = 5 * time.Minute
+
+	// Retention is how long buckets are kept before MongoDB removes them
+	Retention = 90 * 24 * time.Hour
+)
+
+// Bucket summarizes the weight readings of a keg during a period of BucketSize.
+// Weights are in kilograms and levels are percentages of a full keg.
+type Bucket struct {
+	ID         primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	KegID      primitive.ObjectID `bson:"keg_id" json:"keg_id"`
+	Tap        string             `bson:"tap" json:"tap"`
+	Start      time.Time          `bson:"start" json:"start"`
+	Count      int64              `bson:"count" json:"count"`
+	SumWeight  float64            `bson:"sum_weight" json:"sum_weight"`
+	SumLevel   float64            `bson:"sum_level" json:"sum_level"`
+	MinWeight  float64            `bson:"min_weight" json:"min_weight"`
+	MaxWeight  float64            `bson:"max_weight" json:"max_weight"`
+	LastWeight float64            `bson:"last_weight" json:"last_weight"`
+}
+
+// Point is the average level and weight of a tap during a period of a series
+type Point struct {
+	Tap    string    `bson:"tap" json:"tap"`
+	Time   time.Time `bson:"time" json:"time"`
+	Level  float64   `bson:"level" json:"level"`
+	Weight float64   `bson:"weight" json:"weight"`
+}
+
+func init() {
+	// Every keg has a single bucket per period, and old buckets are removed automatically
+	database.RegisterIndexes("telemetry",
+		mongo.IndexModel{
+			Keys:    bson.D{{Key: "keg_id", Value: 1}, {Key: "start", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+		mongo.IndexModel{
+			Keys:    bson.D{{Key: "start", Value: 1}},
+			Options: options.Index().SetExpireAfterSeconds(int32(Retention / time.Second)),
+		},
+	)
+}
+
+// Record adds a weight reading of a keg to the bucket of its period
+func Record(ctx context.Context, kegID primitive.ObjectID, tap string, weight, level float64, at time.Time) error {
+	// Setup the database request
+	collection := database.GetCollection("telemetry")
+	filter := bson.M{"keg_id": kegID, "start": at.Truncate(BucketSize)}
+	update := bson.M{
+		"$setOnInsert": bson.M{"tap": tap},
+		"$inc":         bson.M{"count": 1, "sum_weight": weight, "sum_level": level},
+		"$min":         bson.M{"min_weight": weight},
+		"$max":         bson.M{"max_weight": weight},
+		"$set":         bson.M{"last_weight": weight},
+	}
+
+	// Update or create the bucket in the collection "telemetry"
+	_, err := collection.UpdateOne(ctx, filter, update, options.Update().SetUpsert(true))
+	return err
+}
+
+// Series returns the average level and weight of every tap from one moment until another,
+// combining the buckets into points that are step apart. An empty tap returns all taps.
+func Series(ctx context.Context, tap string, from, to time.Time, step time.Duration) ([]Point, error) {
+	// Setup the database request
+	collection := database.GetCollection("telemetry")
+	match := bson.M{"start": bson.M{"$gte": from, "$lt": to}}
+	if tap != "" {
+		match["tap"] = tap
+	}
+	stepMs := step.Milliseconds()
+	pipeline := bson.A{
+		bson.M{"$match": match},
+		bson.M{"$group": bson.M{
+			"_id": bson.M{
+				"tap":  "$tap",
+				"time": bson.M{"$subtract": bson.A{"$start", bson.M{"$mod": bson.A{bson.M{"$toLong": "$start"}, stepMs}}}},
+			},
+			"count":      bson.M{"$sum": "$count"},
+			"sum_level":  bson.M{"$sum": "$sum_level"},
+			"sum_weight": bson.M{"$sum": "$sum_weight"},
+		}},
+		bson.M{"$project": bson.M{
+			"_id":    0,
+			"tap":    "$_id.tap",
+			"time":   "$_id.time",
+			"level":  bson.M{"$divide": bson.A{"$sum_level", "$count"}},
+			"weight": bson.M{"$divide": bson.A{"$sum_weight", "$count"}},
+		}},
+		bson.M{"$sort": bson.D{{Key: "tap", Value: 1}, {Key: "time", Value: 1}}},
+	}
+
+	// Combine the buckets in the collection "telemetry"
+	cursor, err := collection.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+
+	// Decode all points
+	points := []Point{}
+	if err := cursor.All(ctx, &points); err != nil {
+		return nil, err
+	}
+
+	return points, nil
+}
@@ -0,0 +1,224 @@
+package vouchers
+
+import (
+	"website/utils/database"
+
+	"context"
+	"crypto/rand"
+	"errors"
+	"math/big"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// codeAlphabet leaves out characters that are easily confused on printed coupons
+const codeAlphabet = "ABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+
+// codeLength is the number of characters in a voucher code, without the separator
+const codeLength = 8
+
+// maxInsertAttempts limits how often vouchers whose code is already taken get a new code
+const maxInsertAttempts = 5
+
+var (
+	// ErrNotRedeemable is returned when a code does not exist, has expired, is used up or was already redeemed by the card
+	ErrNotRedeemable = errors.New("voucher cannot be redeemed")
+
+	// ErrNoFreeCodes is returned when no unused codes were found for a batch of vouchers
+	ErrNoFreeCodes = errors.New("could not generate unused voucher codes")
+)
+
+// Voucher represents a code that adds drinks of a product to a card when redeemed
+type Voucher struct {
+	ID         primitive.ObjectID   `bson:"_id,omitempty" json:"id"`
+	Code       string               `bson:"code" json:"code"`
+	Batch      string               `bson:"batch" json:"batch"`
+	ProductID  primitive.ObjectID   `bson:"product_id" json:"product_id"`
+	Beers      uint                 `bson:"beers" json:"beers"`
+	MaxUses    uint                 `bson:"max_uses" json:"max_uses"`
+	Uses       uint                 `bson:"uses" json:"uses"`
+	RedeemedBy []primitive.ObjectID `bson:"redeemed_by" json:"redeemed_by"`
+	ExpiresAt  *time.Time           `bson:"expires_at,omitempty" json:"expires_at,omitempty"`
+	CreatedAt  time.Time            `bson:"created_at" json:"created_at"`
+}
+
+func init() {
+	// Every code identifies a single voucher
+	database.RegisterIndexes("vouchers",
+		mongo.IndexModel{
+			Keys:    bson.D{{Key: "code", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+	)
+}
+
+// generateCode creates a random code written as XXXX-XXXX
+func generateCode() (string, error) {
+	var code strings.Builder
+	max := big.NewInt(int64(len(codeAlphabet)))
+	for i := 0; i < codeLength; i++ {
+		if i == codeLength/2 {
+			code.WriteByte('-')
+		}
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", err
+		}
+		code.WriteByte(codeAlphabet[n.Int64()])
+	}
+	return code.String(), nil
+}
+
+// NormalizeCode turns a code as typed by a customer into the stored form
+func NormalizeCode(code string) string {
+	var plain strings.Builder
+	for _, c := range strings.ToUpper(code) {
+		if strings.ContainsRune(codeAlphabet, c) {
+			plain.WriteRune(c)
+		}
+	}
+	normalized := plain.String()
+	if len(normalized) != codeLength {
+		return normalized
+	}
+	return normalized[:codeLength/2] + "-" + normalized[codeLength/2:]
+}
+
+// New creates a new Voucher instance with a random code. A voucher with one use is
+// single-use; a voucher with more uses can be redeemed once by each of that many cards.
+func New(batch string, productID primitive.ObjectID, beers, maxUses uint, expiresAt *time.Time) (Voucher, error) {
+	code, err := generateCode()
+	if err != nil {
+		return Voucher{}, err
+	}
+
+	return Voucher{
+		Code:       code,
+		Batch:      batch,
+		ProductID:  productID,
+		Beers:      beers,
+		MaxUses:    maxUses,
+		Uses:       0,
+		RedeemedBy: []primitive.ObjectID{},
+		ExpiresAt:  expiresAt,
+		CreatedAt:  time.Now(),
+	}, nil
+}
+
+// InsertMany adds new voucher documents to the "vouchers" collection in MongoDB. Vouchers whose
+// code is already taken get a new code and are inserted again, so codes in batch may change.
+func InsertMany(ctx context.Context, batch []Voucher) error {
+	// Setup the database request
+	collection := database.GetCollection("vouchers")
+	insertOptions := options.InsertMany().SetOrdered(false)
+
+	// Give every voucher its ID up front, so a retry cannot insert it twice
+	pending := make([]int, len(batch))
+	for i := range batch {
+		if batch[i].ID.IsZero() {
+			batch[i].ID = primitive.NewObjectID()
+		}
+		pending[i] = i
+	}
+
+	for attempt := 0; len(pending) > 0; attempt++ {
+		if attempt == maxInsertAttempts {
+			return ErrNoFreeCodes
+		}
+
+		// Insert the vouchers into the collection "vouchers", one taken code does not stop the others
+		documents := make([]interface{}, len(pending))
+		for j, i := range pending {
+			documents[j] = batch[i]
+		}
+		_, err := collection.InsertMany(ctx, documents, insertOptions)
+		if err == nil {
+			return nil
+		}
+
+		// Only vouchers whose code was taken can be inserted again
+		var bulkErr mongo.BulkWriteException
+		if !errors.As(err, &bulkErr) || bulkErr.WriteConcernError != nil || len(bulkErr.WriteErrors) == 0 {
+			return err
+		}
+		retry := make([]int, 0, len(bulkErr.WriteErrors))
+		for _, writeErr := range bulkErr.WriteErrors {
+			if !mongo.IsDuplicateKeyError(writeErr.WriteError) {
+				return err
+			}
+			retry = append(retry, pending[writeErr.Index])
+		}
+
+		// Generate new codes for them
+		for _, i := range retry {
+			code, err := generateCode()
+			if err != nil {
+				return err
+			}
+			batch[i].Code = code
+		}
+		pending = retry
+	}
+
+	return nil
+}
+
+// GetByBatch retrieves the vouchers that were generated together
+func GetByBatch(ctx context.Context, batch string) ([]Voucher, error) {
+	// Setup the database request
+	collection := database.GetCollection("vouchers")
+	filter := bson.M{"batch": batch}
+	findOptions := options.Find().SetSort(bson.D{{Key: "created_at", Value: 1}})
+
+	// Get the vouchers from the collection "vouchers"
+	cursor, err := collection.Find(ctx, filter, findOptions)
+	if err != nil {
+		return nil, err
+	}
+
+	// Decode all vouchers
+	found := []Voucher{}
+	if err := cursor.All(ctx, &found); err != nil {
+		return nil, err
+	}
+
+	return found, nil
+}
+
+// Redeem atomically uses a voucher for a card, but only when it has not expired, has uses
+// left and was not redeemed by the same card before
+func Redeem(ctx context.Context, code string, cardID primitive.ObjectID) (*Voucher, error) {
+	// Setup the database request
+	collection := database.GetCollection("vouchers")
+	filter := bson.M{
+		"code":        NormalizeCode(code),
+		"redeemed_by": bson.M{"$ne": cardID},
+		"$expr":       bson.M{"$lt": bson.A{"$uses", "$max_uses"}},
+		"$or": bson.A{
+			bson.M{"expires_at": nil},
+			bson.M{"expires_at": bson.M{"$gt": time.Now()}},
+		},
+	}
+	update := bson.M{
+		"$inc":  bson.M{"uses": 1},
+		"$push": bson.M{"redeemed_by": cardID},
+	}
+	findOptions := options.FindOneAndUpdate().SetReturnDocument(options.After)
+
+	// Use the voucher in the collection "vouchers"
+	var voucher Voucher
+	err := collection.FindOneAndUpdate(ctx, filter, update, findOptions).Decode(&voucher)
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrNotRedeemable
+	} else if err != nil {
+		return nil, err
+	}
+
+	// If no error was received, return the voucher
+	return &voucher, nil
+}
@@ -0,0 +1,132 @@
+package money
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/bsontype"
+	"go.mongodb.org/mongo-driver/x/bsonx/bsoncore"
+)
+
+// LegacyCurrency is the currency of amounts that were stored as floating point euros
+const LegacyCurrency = "EUR"
+
+// currencyPattern matches ISO 4217 currency codes
+var currencyPattern = regexp.MustCompile(`^[A-Z]{3}$`)
+
+// amountPattern matches decimal amounts with at most two decimals
+var amountPattern = regexp.MustCompile(`^(\d+)(?:\.(\d{1,2}))?$`)
+
+// symbols maps currency codes onto the symbols shown to customers
+var symbols = map[string]string{
+	"EUR": "€",
+	"USD": "$",
+	"GBP": "£",
+}
+
+// Money represents an exact amount of money in the minor unit (cents) of a currency
+type Money struct {
+	Amount   int64  `bson:"amount" json:"amount"`
+	Currency string `bson:"currency" json:"currency"`
+}
+
+// New creates an amount of money from a number of cents
+func New(cents int64, currency string) Money {
+	return Money{Amount: cents, Currency: currency}
+}
+
+// Parse reads a decimal amount such as "2.50" in the given currency
+func Parse(value, currency string) (Money, error) {
+	// Check the currency
+	if !currencyPattern.MatchString(currency) {
+		return Money{}, fmt.Errorf("invalid currency %q", currency)
+	}
+
+	// Split the amount into whole units and cents
+	matches := amountPattern.FindStringSubmatch(strings.TrimSpace(value))
+	if matches == nil {
+		return Money{}, fmt.Errorf("invalid amount %q", value)
+	}
+	units, err := strconv.ParseInt(matches[1], 10, 64)
+	if err != nil {
+		return Money{}, err
+	}
+	cents, _ := strconv.ParseInt((matches[2] + "00")[:2], 10, 64)
+
+	// Guard against overflowing the amount
+	if units > (math.MaxInt64-cents)/100 {
+		return Money{}, fmt.Errorf("amount %q is too large", value)
+	}
+
+	return Money{Amount: units*100 + cents, Currency: currency}, nil
+}
+
+// Times multiplies the amount by a quantity
+func (m Money) Times(quantity uint) Money {
+	return Money{Amount: m.Amount * int64(quantity), Currency: m.Currency}
+}
+
+// Add adds two amounts of the same currency
+func (m Money) Add(other Money) (Money, error) {
+	if m.Currency != other.Currency {
+		return Money{}, errors.New("cannot add amounts of different currencies")
+	}
+	return Money{Amount: m.Amount + other.Amount, Currency: m.Currency}, nil
+}
+
+// Equal reports whether two amounts are exactly the same
+func (m Money) Equal(other Money) bool {
+	return m.Amount == other.Amount && m.Currency == other.Currency
+}
+
+// IsZero reports whether no amount was set, so it can be omitted when stored
+func (m Money) IsZero() bool {
+	return m.Amount == 0 && m.Currency == ""
+}
+
+// String writes the amount as a decimal without currency, such as "2.50"
+func (m Money) String() string {
+	sign := ""
+	amount := m.Amount
+	if amount < 0 {
+		sign = "-"
+		amount = -amount
+	}
+	return fmt.Sprintf("%s%d.%02d", sign, amount/100, amount%100)
+}
+
+// Symbol returns the symbol of the currency, or its code when it has no known symbol
+func (m Money) Symbol() string {
+	if symbol, ok := symbols[m.Currency]; ok {
+		return symbol
+	}
+	return m.Currency + " "
+}
+
+// UnmarshalBSONValue decodes an amount, including the floating point euros stored by older versions
+func (m *Money) UnmarshalBSONValue(t bsontype.Type, data []byte) error {
+	switch t {
+	case bsontype.Double:
+		value, _, ok := bsoncore.ReadDouble(data)
+		if !ok {
+			return errors.New("invalid legacy amount")
+		}
+		*m = Money{Amount: int64(math.Round(value * 100)), Currency: LegacyCurrency}
+		return nil
+	case bsontype.EmbeddedDocument:
+		type plain Money
+		var decoded plain
+		if err := bson.Unmarshal(data, &decoded); err != nil {
+			return err
+		}
+		*m = Money(decoded)
+		return nil
+	default:
+		return fmt.Errorf("cannot decode %v into an amount of money", t)
+	}
+}
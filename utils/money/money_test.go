@@ -0,0 +1,76 @@
+package money
+
+import (
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		value    string
+		currency string
+		want     Money
+		wantErr  bool
+	}{
+		{"2.50", "EUR", New(250, "EUR"), false},
+		{"2.5", "EUR", New(250, "EUR"), false},
+		{"2", "EUR", New(200, "EUR"), false},
+		{"0.05", "USD", New(5, "USD"), false},
+		{" 12.34 ", "EUR", New(1234, "EUR"), false},
+		{"0", "EUR", New(0, "EUR"), false},
+		{"2.505", "EUR", Money{}, true},
+		{"-1.00", "EUR", Money{}, true},
+		{"1,50", "EUR", Money{}, true},
+		{"", "EUR", Money{}, true},
+		{"2.50", "eur", Money{}, true},
+		{"2.50", "", Money{}, true},
+		{"92233720368547758.08", "EUR", Money{}, true},
+	}
+
+	for _, test := range tests {
+		got, err := Parse(test.value, test.currency)
+		if (err != nil) != test.wantErr {
+			t.Errorf("Parse(%q, %q) error = %v, want error %v", test.value, test.currency, err, test.wantErr)
+			continue
+		}
+		if got != test.want {
+			t.Errorf("Parse(%q, %q) = %+v, want %+v", test.value, test.currency, got, test.want)
+		}
+	}
+}
+
+func TestUnmarshalBSONValue(t *testing.T) {
+	tests := []struct {
+		name    string
+		stored  interface{}
+		want    Money
+		wantErr bool
+	}{
+		{"legacy double", 2.5, New(250, LegacyCurrency), false},
+		{"legacy double rounding", 0.1 + 0.2, New(30, LegacyCurrency), false},
+		{"legacy whole euros", 3.0, New(300, LegacyCurrency), false},
+		{"document", bson.M{"amount": int64(199), "currency": "USD"}, New(199, "USD"), false},
+		{"string", "2.50", Money{}, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			data, err := bson.Marshal(bson.M{"price": test.stored})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var decoded struct {
+				Price Money `bson:"price"`
+			}
+			err = bson.Unmarshal(data, &decoded)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("error = %v, want error %v", err, test.wantErr)
+			}
+			if err == nil && decoded.Price != test.want {
+				t.Errorf("decoded %+v, want %+v", decoded.Price, test.want)
+			}
+		})
+	}
+}
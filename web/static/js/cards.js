@@ -0,0 +1,338 @@
+// Current page of the card list and the names of the products by ID
+let currentPage = 1;
+let lastPage = 1;
+let productNames = {};
+
+/**
+ * Function to load the products into every product choice on the page.
+ */
+async function loadProducts() {
+    try {
+        const response = await fetch('/owner/products');
+        if (!response.ok) {
+            throw new Error(`HTTP error! Status: ${response.status}`);
+        }
+        const products = await response.json();
+
+        // Add every product as an option
+        for (const select of document.querySelectorAll('.product-select')) {
+            for (const product of products) {
+                productNames[product.id] = product.name;
+                const option = document.createElement('option');
+                option.value = product.id;
+                option.textContent = product.name;
+                select.appendChild(option);
+            }
+        }
+    } catch (error) {
+        console.error('Error:', error);
+    }
+}
+
+/**
+ * Function to describe the balances of a card.
+ * @param {Object} balances - The balances of the card by product ID.
+ * @returns {string} The balances as readable text.
+ */
+function describeBalances(balances) {
+    return Object.entries(balances || {})
+        .map(([id, beers]) => `${productNames[id] || id}: ${beers}`)
+        .join(', ');
+}
+
+/**
+ * Function to load the current page of cards matching the filter.
+ */
+async function loadCards() {
+    // Build the query from the filter form, leaving out empty fields
+    const query = new URLSearchParams({ page: currentPage });
+    for (const [key, value] of new FormData(document.getElementById('filterForm'))) {
+        if (value !== '') {
+            query.set(key, value);
+        }
+    }
+
+    try {
+        const response = await fetch(`/owner/cards?${query}`);
+        if (!response.ok) {
+            throw new Error(await response.text());
+        }
+        const data = await response.json();
+        lastPage = Math.max(1, Math.ceil(data.total / data.limit));
+
+        // Show a row for every card
+        const rows = document.getElementById('cardRows');
+        rows.replaceChildren();
+        for (const card of data.cards) {
+            const row = rows.insertRow();
+            row.insertCell().textContent = card.server_id;
+
+            // Show the tag of the card, which can be paired at the tap
+            const tag = row.insertCell();
+            tag.textContent = (card.uid || 'None') + ' ';
+            const pair = document.createElement('button');
+            pair.textContent = 'Pair';
+            pair.onclick = () => pairCard(card.server_id);
+            tag.appendChild(pair);
+
+            row.insertCell().textContent = describeBalances(card.balances);
+            const purchased = new Date(card.last_purchase);
+            row.insertCell().textContent = purchased.getFullYear() > 1 ? purchased.toLocaleString() : 'Never';
+
+            // Show whether the card is blocked, or allow blocking it
+            const status = row.insertCell();
+            if (card.blocked) {
+                status.textContent = 'Blocked ';
+
+                // Drinks credited after blocking can still be moved to the replacement
+                if (Object.values(card.balances || {}).some(beers => beers > 0)) {
+                    const move = document.createElement('button');
+                    move.textContent = 'Move to replacement';
+                    move.onclick = () => moveCard(card.server_id);
+                    status.appendChild(move);
+                }
+            } else {
+                const block = document.createElement('button');
+                block.textContent = 'Block';
+                block.onclick = () => blockCard(card.server_id);
+                status.appendChild(block);
+            }
+
+            // Allow deleting the card
+            const remove = document.createElement('button');
+            remove.textContent = 'Delete';
+            remove.onclick = () => deleteCard(card.server_id);
+            row.insertCell().appendChild(remove);
+        }
+        document.getElementById('pageInfo').textContent = `Page ${currentPage} of ${lastPage} (${data.total} cards)`;
+    } catch (error) {
+        console.error('Error:', error);
+    }
+}
+
+/**
+ * Function to apply the filter, starting at the first page.
+ * @param {Event} event - The form submission event.
+ */
+function filterCards(event) {
+    event.preventDefault();
+    currentPage = 1;
+    loadCards();
+}
+
+/**
+ * Function to move through the pages of cards.
+ * @param {number} step - The number of pages to move.
+ */
+function changePage(step) {
+    const page = currentPage + step;
+    if (page >= 1 && page <= lastPage) {
+        currentPage = page;
+        loadCards();
+    }
+}
+
+/**
+ * Function to create one or more cards.
+ * @param {Event} event - The form submission event.
+ */
+async function createCards(event) {
+    event.preventDefault();
+    const message = document.getElementById('createMessage');
+
+    try {
+        const response = await fetch('/owner/cards', {
+            method: 'POST',
+            body: new FormData(event.target),
+        });
+        if (!response.ok) {
+            message.textContent = await response.text();
+            return;
+        }
+        const data = await response.json();
+
+        // Show the new card numbers with a link to their printable sheet
+        const numbers = data.cards.map(card => card.server_id);
+        message.textContent = `Created card ${numbers[0]}` + (numbers.length > 1 ? ` to ${numbers[numbers.length - 1]}` : '') + ' ';
+        const download = document.createElement('a');
+        download.href = `/owner/cards/sheet?batch=${data.batch}`;
+        download.textContent = 'Download printable sheet';
+        message.appendChild(download);
+        loadCards();
+    } catch (error) {
+        console.error('Error:', error);
+    }
+}
+
+/**
+ * Function to correct the balance of a card.
+ * @param {Event} event - The form submission event.
+ */
+async function adjustCard(event) {
+    event.preventDefault();
+    const message = document.getElementById('adjustMessage');
+    const data = new FormData(event.target);
+
+    try {
+        const response = await fetch(`/owner/cards/${data.get('server_id')}/adjust`, {
+            method: 'POST',
+            body: data,
+        });
+        if (!response.ok) {
+            message.textContent = await response.text();
+            return;
+        }
+        const card = await response.json();
+        message.textContent = `Card ${card.server_id}: ${describeBalances(card.balances)}`;
+        loadCards();
+    } catch (error) {
+        console.error('Error:', error);
+    }
+}
+
+/**
+ * Function to block a lost or stolen card and move its balance to a new card.
+ * @param {number} serverID - The number of the card.
+ */
+async function blockCard(serverID) {
+    const reason = prompt(`Block card ${serverID} and move its balance to a new card? Reason:`, 'lost card');
+    if (reason === null) {
+        return;
+    }
+    const message = document.getElementById('createMessage');
+
+    try {
+        const data = new FormData();
+        data.set('reason', reason);
+        const response = await fetch(`/owner/cards/${serverID}/block`, {
+            method: 'POST',
+            body: data,
+        });
+        if (!response.ok) {
+            alert(await response.text());
+            return;
+        }
+        const result = await response.json();
+
+        // Show the replacement with a link to its printable sheet
+        message.textContent = `Card ${serverID} is blocked, its balance moved to card ${result.replacement.server_id} `;
+        const download = document.createElement('a');
+        download.href = `/owner/cards/sheet?batch=${result.replacement.batch}`;
+        download.textContent = 'Download printable sheet';
+        message.appendChild(download);
+        loadCards();
+    } catch (error) {
+        console.error('Error:', error);
+    }
+}
+
+/**
+ * Function to move drinks credited to a blocked card after it was blocked onto its replacement.
+ * @param {number} serverID - The number of the blocked card.
+ */
+async function moveCard(serverID) {
+    const reason = prompt(`Move the balance of blocked card ${serverID} to its replacement? Reason:`, 'credited after the card was blocked');
+    if (reason === null) {
+        return;
+    }
+    const message = document.getElementById('createMessage');
+
+    try {
+        const data = new FormData();
+        data.set('reason', reason);
+        const response = await fetch(`/owner/cards/${serverID}/move`, {
+            method: 'POST',
+            body: data,
+        });
+        if (!response.ok) {
+            alert(await response.text());
+            return;
+        }
+        const result = await response.json();
+
+        message.textContent = `The balance of card ${serverID} moved to card ${result.replacement.server_id}`;
+        loadCards();
+    } catch (error) {
+        console.error('Error:', error);
+    }
+}
+
+/**
+ * Function to delete a card after confirmation.
+ * @param {number} serverID - The number of the card.
+ */
+async function deleteCard(serverID) {
+    if (!confirm(`Delete card ${serverID}?`)) {
+        return;
+    }
+
+    try {
+        const response = await fetch(`/owner/cards/${serverID}`, { method: 'DELETE' });
+        if (!response.ok) {
+            alert(await response.text());
+            return;
+        }
+        loadCards();
+    } catch (error) {
+        console.error('Error:', error);
+    }
+}
+
+/**
+ * Function to bind the next tag scanned at the tap to a card.
+ * @param {number} serverID - The number of the card.
+ */
+async function pairCard(serverID) {
+    const message = document.getElementById('pairingMessage');
+
+    try {
+        const response = await fetch(`/owner/cards/${serverID}/pair`, { method: 'POST' });
+        if (!response.ok) {
+            message.textContent = await response.text();
+            return;
+        }
+        const session = await response.json();
+        message.textContent = `Scan the tag for card ${serverID} at the tap...`;
+        pollPairing(session);
+    } catch (error) {
+        console.error('Error:', error);
+    }
+}
+
+/**
+ * Function to follow the pairing of a tag until it ends.
+ * @param {Object} session - The pairing session that was started.
+ */
+async function pollPairing(session) {
+    const message = document.getElementById('pairingMessage');
+    const serverID = session.server_id;
+
+    try {
+        const response = await fetch('/owner/cards/pairing');
+        if (!response.ok) {
+            throw new Error(`HTTP error! Status: ${response.status}`);
+        }
+        const data = await response.json();
+
+        // Keep waiting while the tap is still pairing this card
+        if (data.current && data.current.started_at === session.started_at) {
+            setTimeout(() => pollPairing(session), 1000);
+            return;
+        }
+
+        // Show how the pairing ended
+        if (data.last && data.last.server_id === serverID && new Date(data.last.at) >= new Date(session.started_at)) {
+            message.textContent = data.last.error
+                ? `Pairing card ${serverID} failed: ${data.last.error}`
+                : `Card ${serverID} is paired with tag ${data.last.uid}`;
+        } else {
+            message.textContent = `Pairing card ${serverID} stopped`;
+        }
+        loadCards();
+    } catch (error) {
+        console.error('Error:', error);
+    }
+}
+
+// Load the products before the cards, so balances show product names
+document.addEventListener('DOMContentLoaded', () => loadProducts().then(loadCards));
@@ -1,15 +1,29 @@
+/**
+ * Function to show the price of the selected product next to the quantity input.
+ */
+function updatePrice() {
+    const select = document.getElementById('productInput');
+    const option = select.options[select.selectedIndex];
+    document.getElementById('priceLabel').textContent = option ? 'x ' + option.dataset.price : '';
+}
+
+// Show the price of the initially selected product
+document.addEventListener('DOMContentLoaded', updatePrice);
+
 /**
  * Function to submit a payment request.
- * @param {string} ID - The unique identifier associated with the payment.
+ * @param {string} token - The secret token of the card being topped up.
  */
-function submitPayment(ID) {
-    // Gather relevant data from the user input field.
+function submitPayment(token) {
+    // Gather relevant data from the user input fields.
     const userInput = document.getElementById('userInput').value;
+    const productInput = document.getElementById('productInput').value;
     
     // Create a data object with payment information.
     const paymentData = {
         quantity: userInput,
-        id: ID,
+        token: token,
+        product: productInput,
     };
 
     // Configure the HTTP request options.
@@ -38,4 +52,123 @@ function submitPayment(ID) {
             // Handle network errors or exceptions.
             console.error('Error:', error);
         });
-}
\ No newline at end of file
+}
+
+/**
+ * Function to redeem a voucher code onto the card.
+ * @param {string} token - The secret token of the card.
+ */
+function redeemVoucher(token) {
+    const code = document.getElementById('voucherInput').value;
+    const message = document.getElementById('voucherMessage');
+
+    // Configure the HTTP request options.
+    const requestOptions = {
+        method: 'POST',
+        headers: {
+            'Content-Type': 'application/json',
+        },
+        body: JSON.stringify({ code: code }),
+    };
+
+    // Send a POST request to the backend to redeem the voucher.
+    fetch(`/client/${token}/voucher`, requestOptions)
+        .then(async response => {
+            if (response.ok) {
+                // Reload the page to show the new balance
+                window.location.reload();
+            } else {
+                // Show why the voucher could not be redeemed
+                message.textContent = await response.text();
+            }
+        })
+        .catch(error => {
+            // Handle network errors or exceptions.
+            console.error('Error:', error);
+        });
+}
+
+/**
+ * Function to transfer drinks from this card to a friend's card.
+ * @param {string} token - The secret token of the card giving away drinks.
+ */
+function transferBeers(token) {
+    const message = document.getElementById('transferMessage');
+
+    // The PIN field is only shown for cards with a PIN.
+    const pin = document.getElementById('transferPIN');
+
+    // Create a data object with transfer information.
+    const transferData = {
+        to: document.getElementById('transferTo').value,
+        product: document.getElementById('transferProduct').value,
+        beers: document.getElementById('transferBeers').value,
+        pin: pin ? pin.value : '',
+    };
+
+    // Configure the HTTP request options.
+    const requestOptions = {
+        method: 'POST',
+        headers: {
+            'Content-Type': 'application/json',
+        },
+        body: JSON.stringify(transferData),
+    };
+
+    // Send a POST request to the backend to move the drinks.
+    fetch(`/client/${token}/transfer`, requestOptions)
+        .then(async response => {
+            if (response.ok) {
+                // Reload the page to show the new balance
+                window.location.reload();
+            } else {
+                // Show why the drinks could not be transferred
+                message.textContent = await response.text();
+            }
+        })
+        .catch(error => {
+            // Handle network errors or exceptions.
+            console.error('Error:', error);
+        });
+}
+
+/**
+ * Function to set, change or remove the PIN of the card.
+ * @param {string} token - The secret token of the card.
+ */
+function setPIN(token) {
+    const message = document.getElementById('pinMessage');
+    const current = document.getElementById('currentPIN');
+
+    // Create a data object with the PIN information.
+    const pinData = {
+        pin: document.getElementById('newPIN').value,
+        current: current ? current.value : '',
+        pours: document.getElementById('pinPours').checked,
+    };
+
+    // Configure the HTTP request options.
+    const requestOptions = {
+        method: 'POST',
+        headers: {
+            'Content-Type': 'application/json',
+        },
+        body: JSON.stringify(pinData),
+    };
+
+    // Send a POST request to the backend to save the PIN.
+    fetch(`/client/${token}/pin`, requestOptions)
+        .then(async response => {
+            if (response.ok) {
+                // Reload the page to show the new PIN state
+                window.location.reload();
+            } else {
+                // Show why the PIN could not be saved
+                message.textContent = await response.text();
+            }
+        })
+        .catch(error => {
+            // Handle network errors or exceptions.
+            console.error('Error:', error);
+        });
+}
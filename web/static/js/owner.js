@@ -1,36 +1,14 @@
 /**
- * Function to fetch the weight.
- * @param {string} endpoint - The API endpoint to fetch the weight.
- * @returns {Promise<number>} A promise that resolves to the capacity value as a number.
+ * Function to fetch the stored state of the kegs on the taps.
+ * @returns {Promise<Array>} A promise that resolves to the kegs.
  */
-async function getWeight(endpoint) {
-    // Configure the HTTP request options for a GET request.
-    const requestOptions = {
-        method: 'GET',
-        headers: {
-            'Content-Type': 'application/json',
-        },
-    };
-
-    try {
-        // Send a GET request to the API endpoint for fetching the weight.
-        const response = await fetch(endpoint, requestOptions);
-
-        if (!response.ok) {
-            throw new Error(`HTTP error! Status: ${response.status}`);
-        }
-
-        // Use response.text() to get the response as a string
-        const data = await response.text();
-
-        // Use the 'data' value as needed (e.g., convert it to a number)
-        const capacityValue = parseInt(data, 10);
-
-        return capacityValue;
-    } catch (error) {
-        console.error('Error:', error);
-        throw error; // Re-throw the error to be caught by the caller
+async function getKegs() {
+    // Send a GET request to the backend for the kegs.
+    const response = await fetch('/owner/kegs');
+    if (!response.ok) {
+        throw new Error(`HTTP error! Status: ${response.status}`);
     }
+    return response.json();
 }
 
 // Function to scale percentage values
@@ -59,3 +37,154 @@ function updateBarStyle(element_id, percentage) {
         console.error('Invalid percentage');
     }
 }
+
+// Function to show the stored state of every keg
+function updateKegs() {
+    getKegs()
+        .then(kegs => {
+            // Render the page again when kegs were tapped or untapped since it was rendered
+            if (kegs.length !== document.querySelectorAll('.bar[data-level]').length) {
+                window.location.reload();
+                return;
+            }
+
+            for (const keg of kegs) {
+                const level = document.getElementById(`level-${keg.id}`);
+                if (!level) {
+                    window.location.reload();
+                    return;
+                }
+                level.textContent = `${keg.level}% \u00b7 ${keg.remaining} of ${keg.volume} L left`;
+                updateBarStyle(`bar-${keg.id}`, keg.level);
+            }
+        })
+        .catch(error => {
+            // Handle errors from the fetch operation
+            console.error('Error in fetch operation:', error);
+        });
+}
+
+/**
+ * Function to tap a new keg, which replaces the keg on its tap.
+ * @param {Event} event - The form submission event.
+ */
+async function tapKeg(event) {
+    event.preventDefault();
+    const message = document.getElementById('kegMessage');
+
+    try {
+        const response = await fetch('/owner/kegs', {
+            method: 'POST',
+            body: new FormData(event.target),
+        });
+        if (!response.ok) {
+            message.textContent = await response.text();
+            return;
+        }
+        window.location.reload();
+    } catch (error) {
+        console.error('Error:', error);
+    }
+}
+
+/**
+ * Function to load the products into the keg form.
+ */
+async function loadKegProducts() {
+    try {
+        const response = await fetch('/owner/products');
+        if (!response.ok) {
+            throw new Error(`HTTP error! Status: ${response.status}`);
+        }
+        const select = document.getElementById('kegProduct');
+        for (const product of await response.json()) {
+            const option = document.createElement('option');
+            option.value = product.id;
+            option.textContent = product.name;
+            select.appendChild(option);
+        }
+    } catch (error) {
+        console.error('Error:', error);
+    }
+}
+
+// Colors of the lines in the history chart, one per tap
+const historyColors = ['#110C52', '#FFA7A7', '#2E86AB', '#4CAF50', '#E67E22'];
+
+/**
+ * Function to draw the level of every tap over a period.
+ * @param {string} period - The period to show, 'day' or 'week'.
+ */
+async function loadHistory(period) {
+    const canvas = document.getElementById('historyChart');
+    const context = canvas.getContext('2d');
+    const legend = document.getElementById('historyLegend');
+
+    try {
+        const response = await fetch(`/owner/telemetry?period=${period}`);
+        if (!response.ok) {
+            throw new Error(`HTTP error! Status: ${response.status}`);
+        }
+        const points = await response.json();
+
+        // Group the points per tap
+        const taps = {};
+        for (const point of points) {
+            (taps[point.tap] = taps[point.tap] || []).push(point);
+        }
+
+        // The horizontal axis runs until now, the vertical axis from empty to full
+        const end = Date.now();
+        const start = end - (period === 'week' ? 7 : 1) * 24 * 60 * 60 * 1000;
+        const x = time => (new Date(time).getTime() - start) / (end - start) * canvas.width;
+        const y = level => canvas.height - level / 100 * canvas.height;
+
+        // Draw the axes
+        context.clearRect(0, 0, canvas.width, canvas.height);
+        context.strokeStyle = '#110c5236';
+        context.lineWidth = 1;
+        for (const level of [0, 25, 50, 75, 100]) {
+            context.beginPath();
+            context.moveTo(0, y(level));
+            context.lineTo(canvas.width, y(level));
+            context.stroke();
+        }
+
+        // Draw a line for every tap
+        legend.replaceChildren();
+        Object.entries(taps).forEach(([tap, series], i) => {
+            const color = historyColors[i % historyColors.length];
+            context.strokeStyle = color;
+            context.lineWidth = 2;
+            context.beginPath();
+            series.forEach((point, j) => {
+                if (j === 0) {
+                    context.moveTo(x(point.time), y(point.level));
+                } else {
+                    context.lineTo(x(point.time), y(point.level));
+                }
+            });
+            context.stroke();
+
+            const label = document.createElement('span');
+            label.style.color = color;
+            label.textContent = `${tap || 'default tap'} `;
+            legend.appendChild(label);
+        });
+        if (points.length === 0) {
+            legend.textContent = 'No readings in this period.';
+        }
+    } catch (error) {
+        console.error('Error:', error);
+    }
+}
+
+// Show the rendered levels, then refresh them every five seconds
+document.addEventListener('DOMContentLoaded', () => {
+    for (const bar of document.querySelectorAll('.bar[data-level]')) {
+        updateBarStyle(bar.id, parseInt(bar.dataset.level, 10));
+    }
+    loadKegProducts();
+    loadHistory('day');
+    setInterval(updateKegs, 5000);
+});